@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/ratelimit"
+)
+
+// bandwidthState is the body of the bandwidth control endpoint.
+type bandwidthState struct {
+	Limit float64 `json:"limitMBps"` // Limit is the maximum download rate in MB per second, zero means no limit.
+}
+
+// newControlHandler returns the handler of the control endpoint. GET /bandwidth returns the current limit,
+// PUT /bandwidth with {"limitMBps": 20} changes it.
+func newControlHandler(limiter *ratelimit.Limiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bandwidth", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var state bandwidthState
+			if err := json.NewDecoder(r.Body).Decode(&state); err != nil || state.Limit < 0 {
+				http.Error(w, "invalid body, expected {\"limitMBps\": N}", http.StatusBadRequest)
+				return
+			}
+			limiter.SetRate(int64(state.Limit * files.MiB))
+			log.Printf("Bandwidth limit is changed to %v MB/s.\n", state.Limit)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bandwidthState{Limit: float64(limiter.Rate()) / files.MiB})
+	})
+	return mux
+}
+
+// startControlServer serves the control endpoint until ctx is done.
+func startControlServer(ctx context.Context, addr string, limiter *ratelimit.Limiter) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newControlHandler(limiter),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		log.Printf("Control endpoint is listening on %s.\n", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Control endpoint error: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/ratelimit"
+)
+
+func TestControlHandler(t *testing.T) {
+	limiter := ratelimit.New(50 * files.MiB)
+	handler := newControlHandler(limiter)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/bandwidth", nil))
+	if got := strings.TrimSpace(recorder.Body.String()); recorder.Code != http.StatusOK || got != `{"limitMBps":50}` {
+		t.Errorf("GET /bandwidth = %d %s", recorder.Code, got)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/bandwidth", strings.NewReader(`{"limitMBps": 2.5}`)))
+	if recorder.Code != http.StatusOK || limiter.Rate() != 5*files.MiB/2 {
+		t.Errorf("PUT /bandwidth = %d, rate %d", recorder.Code, limiter.Rate())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/bandwidth", strings.NewReader(`{"limitMBps": -1}`)))
+	if recorder.Code != http.StatusBadRequest || limiter.Rate() != 5*files.MiB/2 {
+		t.Errorf("PUT /bandwidth with a negative limit = %d, rate %d", recorder.Code, limiter.Rate())
+	}
+}
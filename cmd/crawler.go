@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	_ "net/http/pprof"
+	"os"
 	"runtime"
 	"sync"
 	"time"
@@ -15,28 +17,48 @@ import (
 	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/downloader"
 	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/mirror"
 	"s3-crawler/pkg/profiler"
 	"s3-crawler/pkg/s3client"
+	"s3-crawler/pkg/uploader"
 	"s3-crawler/pkg/utils"
 )
 
 var confPath = flag.String("config", "config1.json", "Path to the configuration file")
 var isProfilingEnabled = flag.Bool("profiling", false, "Enable profiling")
+var isDryRun = flag.Bool("dry-run", false, "Print the files to download without downloading anything")
+var dryRunOutput = flag.String("dry-run-output", "", "Path to save the dry run plan in JSON lines format")
+var failuresOutput = flag.String("failures-output", "", "Path to save the failed files in JSON format")
 
 func main() {
 	flag.Parse()
+	// The exit code is set after the deferred cleanups are done.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 	profilerCleanUpFunc := profiler.SetupProfiling(*isProfilingEnabled)
 	defer profilerCleanUpFunc()
 
 	runTime := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute) // TODO: add timeout to config
-	defer cancel()
-
 	cfg, err := configuration.LoadConfig(*confPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	ctx, cancel := runContext(cfg.GetTimeout())
+	defer cancel()
+	// The listing and new files are stopped by stopCtx, the files in progress are aborted by ctx.
+	stopCtx, stopSignals := handleSignals(ctx, cancel)
+	defer stopSignals()
+	// A failed listing stops the run like a signal, so the files in progress are finished.
+	stopCtx, stopRun := context.WithCancel(stopCtx)
+	defer stopRun()
 	runtime.GOMAXPROCS(int(cfg.NumCPU))
+	if *isDryRun && cfg.Mode != configuration.ModeDownload && cfg.Mode != configuration.ModeSync {
+		log.Fatalf("dry run is supported in the %s and %s modes", configuration.ModeDownload, configuration.ModeSync)
+	}
 	workers := cfg.GetDownloaders()
 
 	client, err := s3client.NewClient(ctx, cfg)
@@ -44,16 +66,72 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if cfg.Mode == configuration.ModeMirror {
+		destination, err := s3client.NewDestinationClient(ctx, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err = mirror.NewMirror(client, destination, cfg).MirrorObjects(ctx, stopCtx); err != nil {
+			log.Println(err)
+			exitCode = 1
+		}
+		fmt.Printf("Programm running total %s\n", time.Since(runTime).Truncate(time.Millisecond))
+		return
+	}
+
 	cache := cacher.NewCache(ctx, cfg)
+	// The upload source is the tree of the user, so neither the state database nor its files are written.
+	if *isDryRun || cfg.Mode == configuration.ModeUpload {
+		cache.SetReadOnly()
+	}
 	if err = cache.LoadFromDir(cfg); err != nil {
 		log.Fatal(err)
 	}
+	defer cache.Close()
+
+	if cfg.Mode == configuration.ModeUpload {
+		manager := uploader.NewUploader(client, cfg)
+		if _, err = manager.UploadFiles(ctx, stopCtx, cache); err != nil {
+			log.Println(err)
+			exitCode = 1
+		}
+		fmt.Printf("Programm running total %s\n", time.Since(runTime).Truncate(time.Millisecond))
+		return
+	}
+
+	if !*isDryRun {
+		previous, err := loadCheckpoint(cfg.LocalPath)
+		if err != nil {
+			log.Println(err)
+		} else if previous != nil {
+			log.Printf("Previous run was interrupted by %s at %s: %d file(s) were pending, %d failed.\n", previous.Reason,
+				previous.InterruptedAt.Format(time.RFC3339), len(previous.Pending), len(previous.Failures))
+		}
+	}
 
 	data := files.NewFileCollection(workers)
-	if err = client.ListObjects(ctx, data, cache); err != nil {
-		log.Fatal(err)
+	go func() {
+		<-stopCtx.Done()
+		data.Stop()
+	}()
+	var extraneous []string
+	// The listing error is returned after the downloads, the extraneous files are handled once they are finished.
+	listed := startListing(stopCtx, stopRun, client, data, cache, func() {
+		if *isDryRun && cfg.Mode == configuration.ModeSync {
+			extraneous = cache.Keys(cfg.Prefix, cfg.IsFlattenName)
+		}
+	})
+
+	if *isDryRun {
+		if err = dryRun(cfg, data, &extraneous, *dryRunOutput); err != nil {
+			log.Fatal(err)
+		}
+		if err = <-listed; err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Programm running total %s\n", time.Since(runTime).Truncate(time.Millisecond))
+		return
 	}
-	data.CreateChannels()
 
 	var wg sync.WaitGroup
 	var wgWrite sync.WaitGroup
@@ -70,28 +148,54 @@ func main() {
 			defer wgWrite.Done()
 			for file := range data.DataChan {
 				<-availableWriters
-				if err := utils.SaveDataToFile(file); err != nil {
+				if err := utils.SaveDataToFile(file, cfg.IsFsync); err != nil {
 					log.Printf("Save file error: %v\n", err)
+					data.MarkAsNotSaved(file, err)
+				} else {
+					cache.Commit(file)
 				}
+				file.ReturnToPool()
 				availableWriters <- struct{}{}
 			}
 		}(data)
 	}
 
+	extractor := archives.NewExtractor(cfg)
 	wg.Add(workers)
 	startDecompress := time.Now()
 	for i := 0; i < workers; i++ {
 		go func(data *files.FileCollection) {
 			defer wg.Done()
 			for file := range data.ArchivesChan {
-				if err := archives.ProcessFile(file, data); err != nil {
+				// A single-stream archive is passed to the writers, the entries of a multi-entry archive are
+				// staged and committed once the whole archive is extracted.
+				var err error
+				isMultiEntry := file.IsMultiEntry()
+				if isMultiEntry {
+					err = extractArchive(extractor, cache, file, cfg.IsFsync)
+				} else {
+					_, err = extractor.ProcessFile(file, data)
+				}
+				switch {
+				case errors.Is(err, archives.ErrUnsafe):
+					log.Printf("Unsafe archive: %v\n", err)
+					data.AddViolation(file, err, true)
+					file.ReturnToPool()
+				case err != nil:
 					log.Printf("Decompress error: %v\n", err)
+					data.MarkAsNotSaved(file, err)
+					file.ReturnToPool()
+				case isMultiEntry:
+					file.ReturnToPool()
 				}
 			}
 		}(data)
 	}
 
-	manager := downloader.NewDownloader(client, cfg)
+	manager := downloader.NewDownloader(client, cfg, cache)
+	if cfg.Bandwidth.ControlAddr != "" {
+		startControlServer(ctx, cfg.Bandwidth.ControlAddr, manager.Limiter())
+	}
 	downloadTime, err := manager.DownloadFiles(ctx, data)
 	if err != nil {
 		log.Println(err)
@@ -112,6 +216,87 @@ func main() {
 	if data.Count() > 0 {
 		utils.TimeTrack(startWrite, "Write files to disk")
 	}
+	listErr := <-listed
+	if listErr != nil {
+		log.Printf("Listing error: %v\n", listErr)
+		exitCode = 1
+	} else if cfg.Mode == configuration.ModeSync && stopCtx.Err() == nil {
+		if err = cache.Sync(cfg); err != nil {
+			log.Println(err)
+			exitCode = 1
+		}
+	}
+	cache.Clear()
+	// The run is interrupted if the listing or the downloads were stopped before stopSignals is called.
+	if stopCtx.Err() != nil {
+		if err = saveCheckpoint(cfg.LocalPath, newCheckpoint(ctx, data, listErr)); err != nil {
+			log.Println(err)
+		}
+		log.Printf("Run is interrupted, %d file(s) are pending. The next run skips the saved files and parts.\n", len(data.Pending()))
+		exitCode = 1
+	} else if err = removeCheckpoint(cfg.LocalPath); err != nil {
+		log.Println(err)
+	}
+	stopSignals()
+	if violations := data.Violations(); len(violations) > 0 {
+		printViolations(os.Stdout, violations)
+		exitCode = 1
+	}
+	if failures := data.Failures(); len(failures) > 0 {
+		printFailures(os.Stdout, failures)
+		if *failuresOutput != "" {
+			if err = saveFailures(*failuresOutput, failures); err != nil {
+				log.Println(err)
+			}
+		}
+		exitCode = 1
+	}
 	fmt.Printf("Programm running total %s\n", time.Since(runTime).Truncate(time.Millisecond))
 	fmt.Scanln("Press ENTER to exit...")
 }
+
+// extractArchive extracts the multi-entry archive held in memory and commits its entries and the archive record.
+// The entries of an archive which fails or is rejected are removed.
+// objectLister lists the objects to download into the DownloadChan of the collection.
+type objectLister interface {
+	ListObjects(ctx context.Context, data *files.FileCollection, cache *cacher.FileCache) error
+}
+
+// startListing lists the objects in the background, so the downloads start with the first listed objects, and
+// closes the DownloadChan once the listing returns. A failed listing stops the run and its error is sent to the
+// returned channel, complete is called only after a complete listing.
+func startListing(stopCtx context.Context, stopRun context.CancelFunc, lister objectLister, data *files.FileCollection,
+	cache *cacher.FileCache, complete func()) <-chan error {
+	listed := make(chan error, 1)
+	go func() {
+		defer close(data.DownloadChan)
+		err := lister.ListObjects(stopCtx, data, cache)
+		if err != nil && stopCtx.Err() == nil {
+			stopRun()
+			listed <- err
+			return
+		}
+		if err != nil {
+			// Extraneous files are unknown until the listing is complete, so they are not handled.
+			log.Printf("Listing is stopped: %v\n", err)
+		} else {
+			complete()
+		}
+		listed <- nil
+	}()
+	return listed
+}
+
+func extractArchive(extractor *archives.Extractor, cache *cacher.FileCache, file *files.File, sync bool) error {
+	stage := archives.NewStage(file, sync)
+	if err := extractor.Extract(file, stage); err != nil {
+		stage.Rollback()
+		return err
+	}
+	entries := stage.Len()
+	if err := stage.Commit(cache.Commit); err != nil {
+		return err
+	}
+	cache.CommitArchive(file, entries)
+	return nil
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"testing"
+	"time"
 
 	"s3-crawler/pkg/cacher"
 	"s3-crawler/pkg/configuration"
@@ -15,28 +15,107 @@ import (
 func TestListObjects(t *testing.T) {
 	const fileCount = 253 // in bucket
 
-	cfg, _ := configuration.LoadConfig("../config.json")
+	cfg, err := configuration.LoadConfig("../config.json")
+	if err != nil {
+		t.Skipf("S3 connection is not configured: %v", err)
+	}
 	client, _ := s3client.NewClient(context.Background(), cfg)
-	data := files.NewObject(fileCount)
-	cache := cacher.NewCache()
-
-	for i := 0; i < 3; i++ {
-		fmt.Println("----------------------------------------")
+	data := files.NewFileCollection(fileCount)
+	cache := cacher.NewCache(context.Background(), cfg)
 
-		err := client.ListObjects(context.Background(), data, cache)
-		if err != nil {
+	go func() {
+		defer close(data.DownloadChan)
+		if err := client.ListObjects(context.Background(), data, cache); err != nil {
 			t.Errorf("ListObjects error: %v", err)
 		}
+	}()
 
-		if len(data.ProcessedChan) != fileCount {
-			t.Errorf("Expected 253 files, got %d", len(data.ProcessedChan))
-		}
+	var listed int
+	for range data.DownloadChan {
+		listed++
+	}
+	if listed != fileCount {
+		t.Errorf("Expected %d files, got %d", fileCount, listed)
+	}
+	if data.Count() != fileCount {
+		t.Errorf("Expected %d files in totals, got %d", fileCount, data.Count())
+	}
+}
+
+var errListing = errors.New("access denied")
 
-		for len(data.ProcessedChan) != 0 {
-			<-data.ProcessedChan
+// pagedLister lists its pages into the DownloadChan like the paginator, the next page is listed once the previous
+// one is released. The listing fails with err after the last page.
+type pagedLister struct {
+	pages   [][]string
+	release chan struct{}
+	err     error
+}
+
+func (lister *pagedLister) ListObjects(ctx context.Context, data *files.FileCollection, _ *cacher.FileCache) error {
+	for i, page := range lister.pages {
+		if i > 0 {
+			select {
+			case <-lister.release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
-		log.Printf("Reset data. Len of objects in channel %d\n", len(data.ProcessedChan))
+		for _, key := range page {
+			data.AddToDownload(&files.File{Key: key, Name: key})
+		}
+	}
+	return lister.err
+}
+
+func TestStartListing(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		complete bool
+	}{
+		{name: "complete listing", complete: true},
+		{name: "listing error", err: errListing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stopCtx, stopRun := context.WithCancel(context.Background())
+			defer stopRun()
+			lister := &pagedLister{pages: [][]string{{"a.csv", "b.csv"}, {"c.csv"}}, release: make(chan struct{}), err: tt.err}
+			data := files.NewFileCollection(1)
+			var completed bool
+			listed := startListing(stopCtx, stopRun, lister, data, nil, func() { completed = true })
+
+			// The objects of the first page are downloaded while the listing waits for the next page.
+			for i := 0; i < 2; i++ {
+				select {
+				case file := <-data.DownloadChan:
+					if file == nil {
+						t.Fatal("DownloadChan is closed before the listing is finished")
+					}
+				case <-time.After(time.Second):
+					t.Fatal("objects are not sent before the listing is finished")
+				}
+			}
+			close(lister.release)
 
-		client.GetPagesCount()
+			var received int
+			for range data.DownloadChan {
+				received++
+			}
+			if received != 1 {
+				t.Errorf("received %d object(s) after the first page, want 1", received)
+			}
+			err := <-listed
+			if !errors.Is(err, tt.err) {
+				t.Errorf("listing error = %v, want %v", err, tt.err)
+			}
+			if (stopCtx.Err() != nil) != (tt.err != nil) {
+				t.Errorf("run stopped = %v, want %v", stopCtx.Err() != nil, tt.err != nil)
+			}
+			if completed != tt.complete {
+				t.Errorf("complete called = %v, want %v", completed, tt.complete)
+			}
+		})
 	}
 }
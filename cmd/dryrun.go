@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+// reasonExtraneous is the reason of a local file which is not present in the bucket in the sync mode.
+const reasonExtraneous = "extraneous"
+
+// planEntry is a single action of the dry run.
+type planEntry struct {
+	Key    string `json:"key,omitempty"` // Key is the key of the object.
+	Path   string `json:"path"`          // Path is the local path of the file.
+	Size   int64  `json:"size"`          // Size is the size of the object in bytes.
+	Reason string `json:"reason"`        // Reason is new, changed or extraneous.
+}
+
+// plan prints the files the run would download and, in the sync mode, the local files it would handle
+// as extraneous. If output is not nil, the entries are written to it as JSON lines.
+type plan struct {
+	stdout io.Writer
+	output *json.Encoder
+	counts map[string]int
+	bytes  int64
+}
+
+func newPlan(stdout io.Writer, output io.Writer) *plan {
+	p := &plan{
+		stdout: stdout,
+		counts: make(map[string]int),
+	}
+	if output != nil {
+		p.output = json.NewEncoder(output)
+	}
+	return p
+}
+
+func (p *plan) add(entry planEntry) error {
+	p.counts[entry.Reason]++
+	p.bytes += entry.Size
+	if entry.Key != "" {
+		fmt.Fprintf(p.stdout, "%-10s %10s %s -> %s\n", entry.Reason, utils.FormatBytes(entry.Size), entry.Key, entry.Path)
+	} else {
+		fmt.Fprintf(p.stdout, "%-10s %10s %s\n", entry.Reason, "", entry.Path)
+	}
+	if p.output != nil {
+		return p.output.Encode(entry)
+	}
+	return nil
+}
+
+func (p *plan) printTotals(cfg *configuration.Configuration) {
+	fmt.Fprintf(p.stdout, "Dry run: %d new file(s), %d changed file(s), total size %s.",
+		p.counts[files.ReasonNew], p.counts[files.ReasonChanged], utils.FormatBytes(p.bytes))
+	if cfg.Mode == configuration.ModeSync {
+		action := "reported"
+		switch {
+		case !cfg.Sync.Delete || cfg.Pagination.MaxPages > 0:
+		case cfg.Sync.TrashDir != "":
+			action = "moved to " + cfg.Sync.TrashDir
+		default:
+			action = "deleted"
+		}
+		fmt.Fprintf(p.stdout, " %d extraneous file(s) would be %s.", p.counts[reasonExtraneous], action)
+	}
+	fmt.Fprintln(p.stdout)
+}
+
+// dryRun consumes the DownloadChan filled by the listing and prints the plan without downloading anything.
+// The extraneous files are read after the DownloadChan is closed, so the listing sets them before closing it.
+func dryRun(cfg *configuration.Configuration, data *files.FileCollection, extraneous *[]string, outputPath string) error {
+	var output io.Writer
+	var buffered *bufio.Writer
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("create dry run output error: %w", err)
+		}
+		defer file.Close()
+		buffered = bufio.NewWriter(file)
+		output = buffered
+	}
+	p := newPlan(os.Stdout, output)
+
+	var err error
+	for file := range data.DownloadChan {
+		if err == nil {
+			err = p.add(planEntry{Key: file.Key, Path: file.LocalPath(), Size: file.Size, Reason: file.Reason})
+		}
+		file.ReturnToPool()
+	}
+	for _, relPath := range *extraneous {
+		if err == nil {
+			err = p.add(planEntry{Path: relPath, Reason: reasonExtraneous})
+		}
+	}
+	if err == nil && buffered != nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("write dry run output error: %w", err)
+	}
+	// clear line
+	fmt.Print("\u001B[2K\r")
+	p.printTotals(cfg)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestPlan(t *testing.T) {
+	var stdout, output strings.Builder
+	p := newPlan(&stdout, &output)
+	entries := []planEntry{
+		{Key: "a/new.txt", Path: "/data/a/new.txt", Size: 1024, Reason: files.ReasonNew},
+		{Key: "a/changed.txt", Path: "/data/a/changed.txt", Size: 1024, Reason: files.ReasonChanged},
+		{Path: "a/old.txt", Reason: reasonExtraneous},
+	}
+	for _, entry := range entries {
+		if err := p.add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantOutput := `{"key":"a/new.txt","path":"/data/a/new.txt","size":1024,"reason":"new"}` + "\n" +
+		`{"key":"a/changed.txt","path":"/data/a/changed.txt","size":1024,"reason":"changed"}` + "\n" +
+		`{"path":"a/old.txt","size":0,"reason":"extraneous"}` + "\n"
+	if output.String() != wantOutput {
+		t.Errorf("JSON lines. \nWant: %s\nGot:  %s", wantOutput, output.String())
+	}
+
+	cfg := configuration.NewConfiguration()
+	cfg.Mode = configuration.ModeSync
+	cfg.Sync.Delete = true
+	p.printTotals(cfg)
+	wantTotals := "Dry run: 1 new file(s), 1 changed file(s), total size 2.0 KB. 1 extraneous file(s) would be deleted.\n"
+	if !strings.HasSuffix(stdout.String(), wantTotals) {
+		t.Errorf("totals. \nWant: %s\nGot:  %s", wantTotals, stdout.String())
+	}
+}
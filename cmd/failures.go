@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"s3-crawler/pkg/files"
+)
+
+// printFailures prints the files which failed permanently as a table.
+func printFailures(w io.Writer, failures []files.Failure) {
+	fmt.Fprintf(w, "Failed %d file(s):\n", len(failures))
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "KEY\tATTEMPTS\tERROR")
+	for _, failure := range failures {
+		fmt.Fprintf(table, "%s\t%d\t%s\n", failure.Key, failure.Attempts, failure.Error)
+	}
+	table.Flush()
+}
+
+// printViolations prints the archives which were not extracted because they are unsafe as a table.
+func printViolations(w io.Writer, violations []files.Violation) {
+	fmt.Fprintf(w, "Rejected %d unsafe archive(s):\n", len(violations))
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "KEY\tREASON")
+	for _, violation := range violations {
+		fmt.Fprintf(table, "%s\t%s\n", violation.Key, violation.Reason)
+	}
+	table.Flush()
+}
+
+// saveFailures writes the files which failed permanently to the file in JSON format.
+func saveFailures(path string, failures []files.Failure) error {
+	content, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("save failures %s error: %w", path, err)
+	}
+	return nil
+}
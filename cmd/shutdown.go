@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/statedb"
+)
+
+// Reasons of an interrupted run.
+const (
+	reasonSignal  = "signal"
+	reasonTimeout = "timeout"
+	reasonListing = "listing error"
+)
+
+// runContext returns the context of the whole run limited by the timeout, zero means no timeout.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// handleSignals returns a context which is canceled by the first SIGINT or SIGTERM. It stops the listing and
+// the processing of new files, while the files in progress are finished. The second signal calls abort,
+// so the files in progress are aborted, the completed parts of large files are kept for the next run.
+// The returned function stops the handling of signals.
+func handleSignals(ctx context.Context, abort context.CancelFunc) (context.Context, func()) {
+	stopCtx, stop := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("Received %s, stopping. Files in progress are finished, repeat to abort them.\n", sig)
+			stop()
+		case <-stopCtx.Done():
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Printf("Received %s, aborting files in progress.\n", sig)
+			abort()
+		case <-ctx.Done():
+		}
+	}()
+	return stopCtx, func() {
+		signal.Stop(signals)
+		stop()
+	}
+}
+
+// checkpoint is the report of an interrupted run: the files which were not saved and why. The next run doesn't
+// depend on it, the saved files are recorded in the state database and the completed parts of large files in
+// their sidecars, so they are skipped anyway.
+type checkpoint struct {
+	InterruptedAt time.Time       `json:"interruptedAt"` // InterruptedAt is the time the run was stopped.
+	Reason        string          `json:"reason"`        // Reason is signal, timeout or listing error.
+	Downloaded    uint32          `json:"downloaded"`    // Downloaded is the number of files downloaded by the run.
+	Pending       []files.Pending `json:"pending"`       // Pending are the listed files which were not downloaded.
+	Failures      []files.Failure `json:"failures"`      // Failures are the files which failed or were aborted.
+}
+
+// newCheckpoint returns the checkpoint of the run stopped by a signal, the timeout of ctx or the listing error.
+func newCheckpoint(ctx context.Context, data *files.FileCollection, listErr error) *checkpoint {
+	reason := reasonSignal
+	switch {
+	case listErr != nil:
+		reason = reasonListing
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		reason = reasonTimeout
+	}
+	_, downloaded, _, _, _, _, _ := data.GetStatistics(time.Second)
+	return &checkpoint{
+		InterruptedAt: time.Now(),
+		Reason:        reason,
+		Downloaded:    downloaded,
+		Pending:       data.Pending(),
+		Failures:      data.Failures(),
+	}
+}
+
+// saveCheckpoint writes the checkpoint to the download directory. The file is replaced atomically.
+func saveCheckpoint(dir string, c *checkpoint) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, statedb.CheckpointName)
+	tmpPath := path + files.TempSuffix
+	if err = os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("save checkpoint error: %w", err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("save checkpoint error: %w", err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint of the previous run, nil if the previous run wasn't interrupted.
+func loadCheckpoint(dir string) (*checkpoint, error) {
+	content, err := os.ReadFile(filepath.Join(dir, statedb.CheckpointName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint error: %w", err)
+	}
+	c := &checkpoint{}
+	if err = json.Unmarshal(content, c); err != nil {
+		return nil, fmt.Errorf("load checkpoint error: %w", err)
+	}
+	return c, nil
+}
+
+// removeCheckpoint removes the checkpoint after a complete run.
+func removeCheckpoint(dir string) error {
+	err := os.Remove(filepath.Join(dir, statedb.CheckpointName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint error: %w", err)
+	}
+	return nil
+}
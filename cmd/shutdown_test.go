@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"s3-crawler/pkg/files"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	if previous, err := loadCheckpoint(dir); previous != nil || err != nil {
+		t.Fatalf("loadCheckpoint without a checkpoint = %v, %v", previous, err)
+	}
+
+	data := files.NewFileCollection(1)
+	data.Stop()
+	data.AddPending(&files.File{Key: "b/pending.txt", Path: "/data/b", Name: "pending.txt", Size: 10})
+	data.AddPending(&files.File{Key: "a/pending.txt", Path: "/data/a", Name: "pending.txt", Size: 20})
+	data.MarkAsFailed(&files.File{Key: "c/aborted.txt", Path: "/data/c", Name: "aborted.txt"}, context.Canceled, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := saveCheckpoint(dir, newCheckpoint(ctx, data, nil)); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := loadCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.Reason != reasonSignal || len(previous.Pending) != 2 || previous.Pending[0].Key != "a/pending.txt" ||
+		len(previous.Failures) != 1 {
+		t.Errorf("loadCheckpoint = %+v", previous)
+	}
+
+	if err = removeCheckpoint(dir); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err = loadCheckpoint(dir); previous != nil || err != nil {
+		t.Errorf("loadCheckpoint after remove = %v, %v", previous, err)
+	}
+}
@@ -0,0 +1,196 @@
+// Command verify audits the local tree against the bucket without downloading anything. It lists the bucket,
+// compares the objects with the local files by the ETag logic of the cache and reports missing, extra,
+// size-mismatched and hash-mismatched files. The exit code is 0 if there is no drift, 1 if there is drift
+// and 2 on error.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"s3-crawler/pkg/cacher"
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/s3client"
+	"s3-crawler/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Exit codes of the command.
+const (
+	exitOK    = 0 // exitOK means the local tree matches the bucket.
+	exitDrift = 1 // exitDrift means the local tree differs from the bucket.
+	exitError = 2 // exitError means the check couldn't be completed.
+)
+
+var confPath = flag.String("config", "config1.json", "Path to the configuration file")
+var reportPath = flag.String("report", "", "Path to save the report in JSON format")
+var timeout = flag.Duration("timeout", 15*time.Minute, "Timeout of the check")
+
+// mismatch is a local file which differs from its object.
+type mismatch struct {
+	Path   string `json:"path"`   // Path is the path of the file relative to the download directory.
+	Key    string `json:"key"`    // Key is the key of the object.
+	Local  string `json:"local"`  // Local is the size or the hash of the local file.
+	Remote string `json:"remote"` // Remote is the size or the ETag of the object.
+}
+
+// report is the result of the comparison of the local tree with the bucket.
+type report struct {
+	Checked      int        `json:"checked"`      // Checked is the number of objects compared with the local files.
+	Missing      []string   `json:"missing"`      // Missing are the keys of objects without local files.
+	Extra        []string   `json:"extra"`        // Extra are the local files without objects.
+	SizeMismatch []mismatch `json:"sizeMismatch"` // SizeMismatch are the local files with a size different from the object.
+	HashMismatch []mismatch `json:"hashMismatch"` // HashMismatch are the local files with a hash different from the object ETag.
+	ExtraSkipped bool       `json:"extraSkipped"` // ExtraSkipped is set if the listing is limited, so extra files are unknown.
+}
+
+func main() {
+	flag.Parse()
+	os.Exit(run())
+}
+
+// run compares the bucket with the local tree and returns the exit code. The local files are hashed by the cache,
+// files unchanged since the last run are trusted by the state database.
+func run() int {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cfg, err := configuration.LoadConfig(*confPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	client, err := s3client.NewClient(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	cache := cacher.NewCache(ctx, cfg)
+	cache.SetReadOnly()
+	if err = cache.LoadFromDir(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer cache.Close()
+
+	result := &report{}
+	err = client.ListBucket(ctx, func(object types.Object) {
+		if !client.IsValidObject(object) {
+			return
+		}
+		file := files.NewFileFromObject(object, cfg.LocalPath, cfg.IsFlattenName, cfg.IsWithDirName, cfg.IsDecompress)
+		defer file.ReturnToPool()
+		key := cache.Key(file)
+		local, _ := cache.GetFile(key)
+		result.add(key, file, local)
+		cache.RemoveFile(key)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if cfg.Pagination.MaxPages > 0 {
+		result.ExtraSkipped = true
+	} else {
+		result.Extra = cache.Keys(cfg.Prefix, cfg.IsFlattenName)
+	}
+	result.sort()
+
+	// clear line
+	fmt.Print("\u001B[2K\r")
+	err = result.print(os.Stdout)
+	if err == nil && *reportPath != "" {
+		err = result.save(*reportPath)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if result.hasDrift() {
+		return exitDrift
+	}
+	return exitOK
+}
+
+// add compares the object with the local file, local is nil if there is no local file.
+func (r *report) add(path string, object, local *files.File) {
+	r.Checked++
+	switch {
+	case local == nil:
+		r.Missing = append(r.Missing, object.Key)
+	case local.Size != object.Size:
+		r.SizeMismatch = append(r.SizeMismatch, mismatch{
+			Path:   path,
+			Key:    object.Key,
+			Local:  utils.FormatBytes(local.Size),
+			Remote: utils.FormatBytes(object.Size),
+		})
+	case local.ETag != object.ETag:
+		r.HashMismatch = append(r.HashMismatch, mismatch{
+			Path:   path,
+			Key:    object.Key,
+			Local:  local.ETag,
+			Remote: object.ETag,
+		})
+	}
+}
+
+func (r *report) sort() {
+	sort.Strings(r.Missing)
+	sort.Strings(r.Extra)
+	sort.Slice(r.SizeMismatch, func(i, j int) bool { return r.SizeMismatch[i].Path < r.SizeMismatch[j].Path })
+	sort.Slice(r.HashMismatch, func(i, j int) bool { return r.HashMismatch[i].Path < r.HashMismatch[j].Path })
+}
+
+func (r *report) hasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.SizeMismatch) > 0 || len(r.HashMismatch) > 0
+}
+
+// save writes the report to the file in JSON format.
+func (r *report) save(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("save report %s error: %w", path, err)
+	}
+	return nil
+}
+
+func (r *report) print(w io.Writer) error {
+	var err error
+	write := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	for _, key := range r.Missing {
+		write("Missing: %s\n", key)
+	}
+	for _, path := range r.Extra {
+		write("Extra: %s\n", path)
+	}
+	for _, m := range r.SizeMismatch {
+		write("Size mismatch: %s local %s, bucket %s\n", m.Path, m.Local, m.Remote)
+	}
+	for _, m := range r.HashMismatch {
+		write("Hash mismatch: %s local %s, bucket %s\n", m.Path, m.Local, m.Remote)
+	}
+	if r.ExtraSkipped {
+		write("Listing is limited by maxPages, extra files are not checked.\n")
+	}
+	write("Checked %d object(s). Missing %d, extra %d, size mismatch %d, hash mismatch %d.\n",
+		r.Checked, len(r.Missing), len(r.Extra), len(r.SizeMismatch), len(r.HashMismatch))
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"s3-crawler/pkg/files"
+)
+
+func TestReportAdd(t *testing.T) {
+	object := &files.File{Key: "dir/file.txt", ETag: "etag", Size: 10}
+	r := &report{}
+
+	r.add("dir/file.txt", object, nil)
+	r.add("dir/file.txt", object, &files.File{ETag: "etag", Size: 12})
+	r.add("dir/file.txt", object, &files.File{ETag: "other", Size: 10})
+	r.add("dir/file.txt", object, &files.File{ETag: "etag", Size: 10})
+
+	if r.Checked != 4 || len(r.Missing) != 1 || len(r.SizeMismatch) != 1 || len(r.HashMismatch) != 1 {
+		t.Errorf("report = %+v", r)
+	}
+	if !r.hasDrift() {
+		t.Errorf("report must have drift")
+	}
+	if (&report{Checked: 1}).hasDrift() {
+		t.Errorf("empty report must not have drift")
+	}
+}
+
+func TestReportPrint(t *testing.T) {
+	r := &report{Checked: 2, Missing: []string{"b", "a"}, Extra: []string{"c"}}
+	r.sort()
+
+	var b strings.Builder
+	if err := r.print(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "Missing: a\nMissing: b\nExtra: c\nChecked 2 object(s). Missing 2, extra 1, size mismatch 0, hash mismatch 0.\n"
+	if b.String() != want {
+		t.Errorf("print. \nWant: %q\nGot:  %q", want, b.String())
+	}
+}
@@ -1,80 +1,192 @@
 package archives
 
 import (
+	"bufio"
 	"bytes"
-	"compress/gzip"
 	"fmt"
 	"io"
-	"sync"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
 	"s3-crawler/pkg/utils"
 )
 
-var supportedArchiveExtensions = []string{".gz", ".gzip"}
-
+// Archiver extracts the archive from its compressed stream r. The extracted files are passed to emit,
+// a single-stream archive passes the file itself.
 type Archiver interface {
-	decompress(file *files.File, data *files.FileCollection) error
+	extract(file *files.File, r io.Reader, emit EmitFunc) (int, error)
 }
 
-type Gzip struct {
-}
+// EmitFunc saves the file extracted from an archive with the content read from r, r is nil for symbolic links.
+// It takes the ownership of the extracted entries, but not of the archive itself.
+type EmitFunc func(file *files.File, r io.Reader) error
 
-var bufferPool = sync.Pool{
-	New: func() interface{} {
-		return new(bytes.Buffer)
-	},
+// Extractor decompresses the downloaded archives. The members of multi-entry archives are filtered by the
+// extensions and the name mask of the configuration, so only the wanted entries are written.
+type Extractor struct {
+	filter *memberFilter
+	limits *limits
 }
 
-func getBuffer() *bytes.Buffer {
-	return bufferPool.Get().(*bytes.Buffer)
+func NewExtractor(cfg *configuration.Configuration) *Extractor {
+	return &Extractor{
+		filter: newMemberFilter(cfg.Extension, cfg.NameMask),
+		limits: &limits{
+			maxRatio:   cfg.Archives.MaxRatio,
+			maxTotal:   cfg.Archives.GetMaxTotal(),
+			maxEntries: cfg.Archives.MaxEntries,
+		},
+	}
 }
 
-func putBuffer(buf *bytes.Buffer) {
-	buf.Reset()
-	bufferPool.Put(buf)
+// ProcessFile выбирает функцию для работы декомпрессора в зависимости от типа файла.
+// It decompresses the single-stream archive in memory, the decompressed data replaces the compressed data and
+// the file is passed to the DataChan. It returns the number of files passed to the DataChan.
+func (e *Extractor) ProcessFile(file *files.File, data *files.FileCollection) (int, error) {
+	archive, err := e.archiver(file, head(file.Data.Bytes()))
+	if err != nil {
+		return 0, err
+	}
+	return archive.extract(file, bytes.NewReader(file.Data.Bytes()), e.guard(file, sendToWriters(file, data)))
 }
 
-func (g *Gzip) decompress(file *files.File, data *files.FileCollection) error {
-	compressedData := getBuffer()
-	defer putBuffer(compressedData)
-	compressedData.Write(file.Data.Bytes())
+// Extract extracts the multi-entry archive held in memory to the stage, so the entries of an archive which
+// fails or is rejected half way are removed by the caller. The archive stays with the caller.
+func (e *Extractor) Extract(file *files.File, stage *Stage) error {
+	archive, err := e.archiver(file, head(file.Data.Bytes()))
+	if err != nil {
+		return err
+	}
+	_, err = archive.extract(file, bytes.NewReader(file.Data.Bytes()), e.guard(file, stage.Save))
+	return err
+}
 
-	archive, err := gzip.NewReader(compressedData)
+// Stream decompresses the archive read sequentially from r, save is called for every extracted file, so
+// the files can be written straight to disk. Zip archives are spooled to a temporary file, because their
+// directory is at the end. It returns the number of saved files.
+func (e *Extractor) Stream(file *files.File, r io.Reader, save EmitFunc) (int, error) {
+	buffered := bufio.NewReaderSize(r, HeadSize)
+	// A short archive is detected by the bytes it has, the error is returned by the archiver.
+	peeked, _ := buffered.Peek(HeadSize)
+	archive, err := e.archiver(file, peeked)
 	if err != nil {
-		return fmt.Errorf("gzip reader error: %w", err)
+		return 0, err
 	}
-	defer archive.Close()
+	return archive.extract(file, buffered, e.guard(file, save))
+}
 
-	buffer := getBuffer()
-	defer putBuffer(buffer)
+// guard returns emit which checks the safety limits of the archive.
+func (e *Extractor) guard(file *files.File, emit EmitFunc) EmitFunc {
+	g := &guard{limits: e.limits, archive: file}
+	return g.wrap(emit)
+}
 
-	if _, err = io.Copy(buffer, archive); err != nil {
-		return err
+// archiver returns the archiver of the registered format of the file.
+func (e *Extractor) archiver(file *files.File, head []byte) (Archiver, error) {
+	c := codecOf(file, head)
+	if c == nil {
+		return nil, fmt.Errorf("unsupported archive type")
 	}
+	return c.archiver(e.filter), nil
+}
 
-	file.Data.Reset()
-	file.Data.Grow(buffer.Len())
-	if _, err = buffer.WriteTo(file.Data); err != nil {
-		return err
+// maxGrow is the maximum size of the buffer allocated for an entry by the size declared in the archive.
+// The declared size of an untrusted archive can be anything, so larger entries grow while they are read.
+const maxGrow = 64 * files.MiB
+
+// sendToWriters returns the function which reads the extracted files into memory and passes them to the DataChan.
+// The decompressed data of a single-stream archive replaces its compressed data once it is read.
+func sendToWriters(archive *files.File, data *files.FileCollection) EmitFunc {
+	return func(file *files.File, r io.Reader) error {
+		if r != nil {
+			buffer := files.NewBuffer()
+			if file != archive && file.Size > 0 && file.Size <= maxGrow {
+				buffer.Grow(int(file.Size))
+			}
+			if _, err := io.Copy(buffer, r); err != nil {
+				buffer.Release()
+				if file != archive {
+					file.ReturnToPool()
+				}
+				return fmt.Errorf("extract %s error: %w", file.Name, err)
+			}
+			file.Data.Release()
+			file.Data = buffer
+		}
+		data.DataChan <- file
+		return nil
 	}
-	data.DataChan <- file
+}
 
-	return nil
+// memberFilter selects the members of multi-entry archives. The archive extensions are removed from the
+// extensions, so with the extensions "zip,csv" only csv files are extracted from the zip archives.
+type memberFilter struct {
+	extensions []string
+	nameMask   string
 }
 
-// ProcessFile выбирает функцию для работы декомпрессора в зависимости от типа файла.
-func ProcessFile(file *files.File, data *files.FileCollection) error {
-	var archive Archiver
-	switch file.Extension {
-	case ".gz", ".gzip":
-		archive = &Gzip{}
-		return archive.decompress(file, data)
-	default:
-		return fmt.Errorf("unsupported archive type")
+func newMemberFilter(extension, nameMask string) *memberFilter {
+	var extensions []string
+	for _, ext := range strings.Split(extension, ",") {
+		if ext == "" || IsSupportedArchive("."+strings.TrimPrefix(ext, ".")) {
+			continue
+		}
+		extensions = append(extensions, ext)
+	}
+	return &memberFilter{
+		extensions: extensions,
+		nameMask:   strings.ToLower(nameMask),
+	}
+}
+
+// match reports whether the member with the slash-separated name is extracted.
+func (f *memberFilter) match(name string) bool {
+	if f == nil {
+		return true
 	}
+	base := strings.ToLower(path.Base(name))
+	return utils.HasValidExtension(base, f.extensions) && utils.HasValidName(base, f.nameMask)
+}
+
+// newEntry returns a file for the entry of the archive. The entry is saved to the path of the archive, so
+// entries of different archives don't collide if the archive name is included into the path.
+func newEntry(archive *files.File, name string, size int64, modTime time.Time) (*files.File, error) {
+	name, err := entryName(archive, name)
+	if err != nil {
+		return nil, err
+	}
+	entry := files.NewFile()
+	entry.Key = archive.Key
+	entry.ETag = archive.ETag
+	entry.Archive = archive.LocalPath()
+	entry.Path = filepath.Join(archive.Path, filepath.FromSlash(path.Dir(name)))
+	entry.Name = path.Base(name)
+	entry.Extension = files.Ext(name)
+	entry.Size = size
+	entry.ModTime = modTime
+	return entry, nil
+}
+
+// entryName returns the clean slash-separated name of the entry. Absolute names and names outside
+// of the output directory are rejected.
+func entryName(archive *files.File, name string) (string, error) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(name) || isOutside(name) {
+		return "", fmt.Errorf("%w: entry %s of %s is outside of the output directory", ErrUnsafe, name, archive.Key)
+	}
+	return name, nil
+}
+
+// unsafeEntry returns the error for the entry of the archive which resolves outside of the output directory.
+func unsafeEntry(archive *files.File, name string, err error) error {
+	return fmt.Errorf("%w: entry %s of %s: %v", ErrUnsafe, name, archive.Key, err)
 }
 
-func IsSupportedArchive(name string) bool {
-	return utils.HasValidExtension(name, supportedArchiveExtensions)
+// isOutside reports whether the clean relative path points outside of the directory.
+func isOutside(name string) bool {
+	return name == ".." || strings.HasPrefix(name, "../")
 }
@@ -0,0 +1,102 @@
+package archives
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"s3-crawler/pkg/files"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+func init() {
+	register(&codec{name: "gzip", magic: []byte{0x1f, 0x8b}, archiver: compressed(openGzip)}, ".gz", ".gzip")
+	register(&codec{name: "bzip2", magic: []byte("BZh"), archiver: compressed(openBzip2)}, ".bz2")
+	register(&codec{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, archiver: compressed(openXz)}, ".xz")
+	register(&codec{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, archiver: compressed(openZstd)}, ".zst")
+	register(&codec{name: "lz4", magic: []byte{0x04, 0x22, 0x4d, 0x18}, archiver: compressed(openLz4)}, ".lz4")
+	register(&codec{name: "snappy", magic: []byte("\xff\x06\x00\x00sNaPpY"), archiver: compressed(openSnappy)}, ".sz", ".snappy")
+
+	register(&codec{name: "zip", magic: []byte("PK\x03\x04"), multiEntry: true, archiver: func(filter *memberFilter) Archiver {
+		return &Zip{filter: filter}
+	}}, ".zip")
+	register(&codec{name: "tar", magic: []byte("ustar"), offset: 257, multiEntry: true, archiver: tarOf(nil)}, ".tar")
+	register(&codec{name: "tar.gz", multiEntry: true, archiver: tarOf(openGzip)}, ".tgz", ".tar.gz")
+	register(&codec{name: "tar.bz2", multiEntry: true, archiver: tarOf(openBzip2)}, ".tbz2", ".tar.bz2")
+	register(&codec{name: "tar.xz", multiEntry: true, archiver: tarOf(openXz)}, ".txz", ".tar.xz")
+	register(&codec{name: "tar.zst", multiEntry: true, archiver: tarOf(openZstd)}, ".tzst", ".tar.zst")
+}
+
+// opener returns the reader of the data compressed by a single-stream codec.
+type opener func(r io.Reader) (io.ReadCloser, error)
+
+// Compressed is the archiver of a single-stream codec, the decompressed data is the only entry.
+type Compressed struct {
+	open opener
+}
+
+func compressed(open opener) func(*memberFilter) Archiver {
+	return func(*memberFilter) Archiver {
+		return &Compressed{open: open}
+	}
+}
+
+func (c *Compressed) extract(file *files.File, r io.Reader, emit EmitFunc) (int, error) {
+	reader, err := c.open(r)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	if err = emit(file, reader); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func tarOf(open opener) func(*memberFilter) Archiver {
+	return func(filter *memberFilter) Archiver {
+		return &Tar{filter: filter, open: open}
+	}
+}
+
+func openGzip(r io.Reader) (io.ReadCloser, error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader error: %w", err)
+	}
+	return reader, nil
+}
+
+func openBzip2(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func openXz(r io.Reader) (io.ReadCloser, error) {
+	reader, err := xz.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("xz reader error: %w", err)
+	}
+	return io.NopCloser(reader), nil
+}
+
+func openZstd(r io.Reader) (io.ReadCloser, error) {
+	reader, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("zstd reader error: %w", err)
+	}
+	return reader.IOReadCloser(), nil
+}
+
+func openLz4(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+func openSnappy(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
@@ -0,0 +1,78 @@
+package archives
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+// ErrUnsafe is returned for an archive with an entry outside of the output directory or an archive which exceeds
+// the safety limits. Such an archive is not extracted again by a retry.
+var ErrUnsafe = errors.New("unsafe archive")
+
+// minRatioSize is the extracted size from which the expansion ratio is checked, so small archives of repeated
+// data are never rejected.
+const minRatioSize = files.MiB
+
+// limits are the safety limits of a single archive, zero values are not checked.
+type limits struct {
+	maxRatio   float64 // maxRatio is the maximum ratio of the extracted size to the size of the archive.
+	maxTotal   int64   // maxTotal is the maximum extracted size in bytes.
+	maxEntries int     // maxEntries is the maximum number of extracted entries.
+}
+
+// guard checks the limits while a single archive is extracted. The extracted size is counted by the bytes
+// read from the entries, so the sizes declared by the archive are never trusted.
+type guard struct {
+	limits  *limits
+	archive *files.File
+	total   int64 // total is the number of extracted bytes.
+	entries int   // entries is the number of extracted entries.
+}
+
+// wrap returns emit which counts the entries and the bytes read from them.
+func (g *guard) wrap(emit EmitFunc) EmitFunc {
+	return func(file *files.File, r io.Reader) error {
+		g.entries++
+		if g.limits.maxEntries > 0 && g.entries > g.limits.maxEntries {
+			if file != g.archive {
+				file.ReturnToPool()
+			}
+			return fmt.Errorf("%w: %s has more than %d entries", ErrUnsafe, g.archive.Key, g.limits.maxEntries)
+		}
+		if r != nil {
+			r = &guardedReader{guard: g, reader: r}
+		}
+		return emit(file, r)
+	}
+}
+
+// check returns an error if the extracted size exceeds the limits.
+func (g *guard) check() error {
+	if g.limits.maxTotal > 0 && g.total > g.limits.maxTotal {
+		return fmt.Errorf("%w: %s expands to more than %s", ErrUnsafe, g.archive.Key, utils.FormatBytes(g.limits.maxTotal))
+	}
+	if g.limits.maxRatio > 0 && g.total > minRatioSize && g.archive.Size > 0 &&
+		float64(g.total) > g.limits.maxRatio*float64(g.archive.Size) {
+		return fmt.Errorf("%w: %s expands more than %v times", ErrUnsafe, g.archive.Key, g.limits.maxRatio)
+	}
+	return nil
+}
+
+// guardedReader counts the bytes read from an entry and fails once the archive exceeds the limits.
+type guardedReader struct {
+	guard  *guard
+	reader io.Reader
+}
+
+func (gr *guardedReader) Read(p []byte) (int, error) {
+	n, err := gr.reader.Read(p)
+	gr.guard.total += int64(n)
+	if limitErr := gr.guard.check(); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
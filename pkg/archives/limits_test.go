@@ -0,0 +1,81 @@
+package archives
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestLimits(t *testing.T) {
+	var bomb bytes.Buffer
+	w := gzip.NewWriter(&bomb)
+	w.Write(make([]byte, 8*files.MiB))
+	w.Close()
+
+	var entries bytes.Buffer
+	writer := zip.NewWriter(&entries)
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		w, _ := writer.Create(name)
+		w.Write([]byte(name))
+	}
+	writer.Close()
+
+	var slip bytes.Buffer
+	writer = zip.NewWriter(&slip)
+	writer.Create("../../evil.sh")
+	writer.Close()
+
+	links := make(map[string]*bytes.Buffer)
+	for _, target := range []string{"app.log", "../../etc/passwd", "/etc/shadow"} {
+		links[target] = &bytes.Buffer{}
+		tw := tar.NewWriter(links[target])
+		tw.WriteHeader(&tar.Header{Name: "logs/latest.log", Typeflag: tar.TypeSymlink, Linkname: target})
+		tw.Close()
+	}
+
+	tests := []struct {
+		name    string
+		archive *bytes.Buffer
+		ext     string
+		limits  configuration.ArchivesConfig
+		unsafe  bool
+	}{
+		{name: "ratio", archive: &bomb, ext: ".gz", limits: configuration.ArchivesConfig{MaxRatio: 100}, unsafe: true},
+		{name: "total", archive: &bomb, ext: ".gz", limits: configuration.ArchivesConfig{MaxTotal: 4}, unsafe: true},
+		{name: "within limits", archive: &bomb, ext: ".gz", limits: configuration.ArchivesConfig{MaxRatio: 10000, MaxTotal: 16}},
+		{name: "entries", archive: &entries, ext: ".zip", limits: configuration.ArchivesConfig{MaxEntries: 2}, unsafe: true},
+		{name: "entries within limit", archive: &entries, ext: ".zip", limits: configuration.ArchivesConfig{MaxEntries: 3}},
+		{name: "zip slip", archive: &slip, ext: ".zip", unsafe: true},
+		{name: "link", archive: links["app.log"], ext: ".tar"},
+		{name: "link outside", archive: links["../../etc/passwd"], ext: ".tar", unsafe: true},
+		{name: "absolute link", archive: links["/etc/shadow"], ext: ".tar", unsafe: true},
+	}
+	for _, test := range tests {
+		file := &files.File{Key: "drop" + test.ext, Extension: test.ext, Path: t.TempDir(), Name: "drop", Size: int64(test.archive.Len()), Data: files.NewBuffer()}
+		file.Data.Write(test.archive.Bytes())
+		extractor := NewExtractor(&configuration.Configuration{Archives: test.limits})
+		var err error
+		if file.IsMultiEntry() {
+			stage := NewStage(file, false)
+			err = extractor.Extract(file, stage)
+			stage.Rollback()
+		} else {
+			data := files.NewFileCollection(4)
+			go func() {
+				for range data.DataChan {
+				}
+			}()
+			_, err = extractor.ProcessFile(file, data)
+			close(data.DataChan)
+		}
+		if unsafe := errors.Is(err, ErrUnsafe); unsafe != test.unsafe {
+			t.Errorf("%s: extract error %v, want unsafe %t", test.name, err, test.unsafe)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package archives
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinks is the maximum number of symbolic links followed while a single path is resolved.
+const maxLinks = 40
+
+// tree resolves the paths of the entries of a single archive inside of its output directory the way the system
+// does when the entries are written. The symbolic links are taken from the links extracted from the archive
+// before and from the disk, so a path can't leave the directory through a chain of links. The entries are
+// written to their resolved paths, so they don't depend on the links being on disk yet.
+type tree struct {
+	root  string            // root is the output directory of the archive.
+	links map[string]string // links are the targets of the extracted links by their resolved slash-separated paths.
+}
+
+func newTree(root string) *tree {
+	return &tree{root: root, links: make(map[string]string)}
+}
+
+// dir returns the resolved path of the directory with the clean slash-separated name.
+func (t *tree) dir(name string) (string, error) {
+	var links int
+	return t.walk(".", name, &links)
+}
+
+// file returns the resolved path of the file with the clean slash-separated name. The file itself is replaced
+// when it is written, so only its directory is resolved. A link extracted before with the same path is forgotten.
+func (t *tree) file(name string) (string, error) {
+	dir, err := t.dir(path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	resolved := path.Join(dir, path.Base(name))
+	delete(t.links, resolved)
+	return resolved, nil
+}
+
+// link returns the resolved path of the symbolic link with the clean slash-separated name, if its target
+// resolves inside of the output directory, and remembers the link for the entries which follow.
+func (t *tree) link(name, target string) (string, error) {
+	resolved, err := t.file(name)
+	if err != nil {
+		return "", err
+	}
+	var links int
+	if _, err = t.walk(path.Dir(resolved), filepath.ToSlash(target), &links); err != nil {
+		return "", fmt.Errorf("link target %s: %w", target, err)
+	}
+	t.links[resolved] = filepath.ToSlash(target)
+	return resolved, nil
+}
+
+// walk resolves the slash-separated name relative to the resolved directory, the links on the way are followed.
+func (t *tree) walk(resolved, name string, links *int) (string, error) {
+	if name == "" || path.IsAbs(name) {
+		return "", fmt.Errorf("%q is not a relative path", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", fmt.Errorf("%s is outside of the output directory", name)
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		target, ok := t.target(next)
+		if !ok {
+			resolved = next
+			continue
+		}
+		if *links++; *links > maxLinks {
+			return "", fmt.Errorf("%s has too many levels of symbolic links", name)
+		}
+		var err error
+		if resolved, err = t.walk(resolved, target, links); err != nil {
+			return "", err
+		}
+	}
+	return resolved, nil
+}
+
+// target returns the target of the symbolic link with the resolved path, if the path is a link.
+func (t *tree) target(resolved string) (string, bool) {
+	if target, ok := t.links[resolved]; ok {
+		return target, true
+	}
+	target, err := os.Readlink(filepath.Join(t.root, filepath.FromSlash(resolved)))
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(target), true
+}
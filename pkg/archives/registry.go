@@ -0,0 +1,101 @@
+package archives
+
+import (
+	"bytes"
+	"log"
+
+	"s3-crawler/pkg/files"
+)
+
+// HeadSize is the number of the first bytes of the data enough to detect any registered format.
+const HeadSize = 512
+
+// codec is a registered archive format.
+type codec struct {
+	name       string
+	extension  string // extension is the first registered extension of the format.
+	magic      []byte // magic are the bytes of the format at the offset, nil if the format isn't detected by them.
+	offset     int
+	multiEntry bool                                // multiEntry is set for formats with several entries, like zip.
+	archiver   func(filter *memberFilter) Archiver // archiver returns the archiver of the format.
+}
+
+var (
+	codecs   = make(map[string]*codec) // codecs are the registered formats by extension.
+	detected []*codec                  // detected are the formats with magic bytes in the order of registration.
+)
+
+// register registers the format for the extensions, the extensions are registered in the files package as well.
+// The formats with magic bytes are detected by them when the extension of a file is missing or doesn't match its data.
+func register(c *codec, extensions ...string) {
+	c.extension = extensions[0]
+	for _, ext := range extensions {
+		codecs[ext] = c
+		files.RegisterArchive(ext, c.multiEntry)
+	}
+	if c.magic != nil {
+		detected = append(detected, c)
+	}
+}
+
+// matches reports whether the data starting with head is of the format.
+func (c *codec) matches(head []byte) bool {
+	end := c.offset + len(c.magic)
+	return len(head) >= end && bytes.Equal(head[c.offset:end], c.magic)
+}
+
+// detect returns the format of the data starting with head, nil if the format is unknown.
+func detect(head []byte) *codec {
+	for _, c := range detected {
+		if c.matches(head) {
+			return c
+		}
+	}
+	return nil
+}
+
+// codecOf returns the format of the file by its extension, nil if it is unknown. If the extension is missing or
+// the data doesn't start with the magic bytes of the format, the format is detected by the magic bytes. A multi-entry
+// archive is never detected as a single-stream one and back, because their entries are saved to different paths.
+func codecOf(file *files.File, head []byte) *codec {
+	c := codecs[file.Extension]
+	if c != nil && (c.magic == nil || c.matches(head)) {
+		return c
+	}
+	if d := detect(head); d != nil && d.multiEntry == file.IsMultiEntry() {
+		if c != nil {
+			log.Printf("File %s is %s, not %s.\n", file.Key, d.name, c.name)
+		}
+		return d
+	}
+	return c
+}
+
+// Detect returns the extension of the registered single-stream codec the data starting with head is compressed by,
+// empty if the data isn't compressed.
+func Detect(head []byte) string {
+	if c := detect(head); c != nil && !c.multiEntry {
+		return c.extension
+	}
+	return ""
+}
+
+// IsSupportedArchive reports whether the extension of the name is registered.
+func IsSupportedArchive(name string) bool {
+	_, ok := codecs[files.Ext(name)]
+	return ok
+}
+
+// IsMultiEntry reports whether the extension of the name is registered for a format with several entries.
+func IsMultiEntry(name string) bool {
+	c, ok := codecs[files.Ext(name)]
+	return ok && c.multiEntry
+}
+
+// head returns the first bytes of the data to detect its format.
+func head(data []byte) []byte {
+	if len(data) > HeadSize {
+		return data[:HeadSize]
+	}
+	return data
+}
@@ -0,0 +1,94 @@
+package archives
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2Hello is "hello\n" compressed by bzip2, the standard library has no bzip2 writer.
+var bzip2Hello = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc1, 0xc0, 0x80, 0xe2, 0x00, 0x00,
+	0x01, 0x41, 0x00, 0x00, 0x10, 0x02, 0x44, 0xa0, 0x00, 0x30, 0xcd, 0x00, 0xc3, 0x46, 0x29, 0x97,
+	0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0xc1, 0xc0, 0x80, 0xe2,
+}
+
+func compress(t *testing.T, ext string, content []byte) []byte {
+	var buffer bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(&buffer)
+	case ".bz2":
+		return bzip2Hello
+	case ".xz":
+		w, err = xz.NewWriter(&buffer)
+	case ".zst":
+		w, err = zstd.NewWriter(&buffer)
+	case ".lz4":
+		w = lz4.NewWriter(&buffer)
+	case ".sz":
+		w = snappy.NewBufferedWriter(&buffer)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCodecs(t *testing.T) {
+	extractor := NewExtractor(&configuration.Configuration{})
+	for _, ext := range []string{".gz", ".bz2", ".xz", ".zst", ".lz4", ".sz"} {
+		compressed := compress(t, ext, []byte("hello\n"))
+		// The extension is right, wrong or missing, the format is detected by the magic bytes.
+		for _, fileExt := range []string{ext, ".gz", ""} {
+			file := &files.File{Key: "app.log" + fileExt, Extension: fileExt, Name: "app.log", Data: files.NewBuffer()}
+			file.Data.Write(compressed)
+			data := files.NewFileCollection(1)
+			count, err := extractor.ProcessFile(file, data)
+			if err != nil || count != 1 {
+				t.Errorf("ProcessFile(%s as %q) = %d, %v", ext, fileExt, count, err)
+				continue
+			}
+			if got := (<-data.DataChan).Data.String(); got != "hello\n" {
+				t.Errorf("ProcessFile(%s as %q) content %q", ext, fileExt, got)
+			}
+		}
+		if got := Detect(compressed); codecs[got] != codecs[ext] {
+			t.Errorf("Detect(%s) = %q", ext, got)
+		}
+	}
+	if got := Detect([]byte("hello\n")); got != "" {
+		t.Errorf("Detect of plain text = %q", got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	// The save paths are defined by the files package, so every format must be registered there as well.
+	for ext, c := range codecs {
+		file := &files.File{Extension: ext}
+		if !file.IsArchive() || file.IsMultiEntry() != c.multiEntry {
+			t.Errorf("extension %s of %s: archive %t, multi-entry %t", ext, c.name, file.IsArchive(), file.IsMultiEntry())
+		}
+		if !IsSupportedArchive("data" + ext) {
+			t.Errorf("IsSupportedArchive(data%s) = false", ext)
+		}
+	}
+	if IsSupportedArchive("data.rar") {
+		t.Errorf("IsSupportedArchive(data.rar) = true")
+	}
+}
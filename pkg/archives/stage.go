@@ -0,0 +1,85 @@
+package archives
+
+import (
+	"io"
+	"os"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+// Stage keeps the files extracted from a single archive at their temporary paths. Commit renames them to their
+// paths once the whole archive is extracted and verified, Rollback removes them, so an archive which fails
+// leaves no files behind.
+type Stage struct {
+	archive *files.File
+	sync    bool
+	files   []*files.File
+	paths   map[string]int // paths are the indexes of the staged files by their local paths.
+}
+
+// NewStage returns the stage of the archive, the files are flushed to disk if sync is set.
+func NewStage(archive *files.File, sync bool) *Stage {
+	return &Stage{archive: archive, sync: sync, paths: make(map[string]int)}
+}
+
+// Save writes the extracted file to its temporary path, it is the EmitFunc of the stage. A file extracted
+// again with the same path replaces the staged one, as it would replace the saved one.
+func (s *Stage) Save(file *files.File, r io.Reader) error {
+	if err := utils.WriteTempFile(file, r, s.sync); err != nil {
+		s.release(file)
+		return err
+	}
+	if i, ok := s.paths[file.LocalPath()]; ok {
+		s.release(s.files[i])
+		s.files[i] = file
+		return nil
+	}
+	s.paths[file.LocalPath()] = len(s.files)
+	s.files = append(s.files, file)
+	return nil
+}
+
+// Len returns the number of staged files.
+func (s *Stage) Len() int {
+	return len(s.files)
+}
+
+// Commit renames the staged files to their paths and passes them to commit. Once a rename fails, the rest
+// of the files are removed and the error is returned.
+func (s *Stage) Commit(commit func(file *files.File)) error {
+	var err error
+	for _, file := range s.files {
+		if err == nil {
+			if err = utils.CommitTempFile(file); err == nil {
+				commit(file)
+			}
+		} else {
+			os.Remove(file.TempPath())
+		}
+		s.release(file)
+	}
+	s.reset()
+	return err
+}
+
+// Rollback removes the staged files.
+func (s *Stage) Rollback() {
+	for _, file := range s.files {
+		os.Remove(file.TempPath())
+		s.release(file)
+	}
+	s.reset()
+}
+
+func (s *Stage) reset() {
+	s.files = nil
+	s.paths = make(map[string]int)
+}
+
+// release returns the extracted entry to the pool, the archive stays with its owner.
+func (s *Stage) release(file *files.File) {
+	if file != s.archive {
+		file.ReturnToPool()
+	}
+}
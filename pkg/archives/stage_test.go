@@ -0,0 +1,48 @@
+package archives
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"s3-crawler/pkg/files"
+)
+
+func TestStage(t *testing.T) {
+	dir := t.TempDir()
+	archive := &files.File{Key: "drop.zip", Extension: ".zip", Path: dir, Name: "drop.zip"}
+	stageEntries := func() *Stage {
+		stage := NewStage(archive, false)
+		for _, entry := range []struct{ name, content string }{{"a.log", "1"}, {"b.log", "2"}, {"a.log", "3"}} {
+			file := files.NewFile()
+			file.Path, file.Name = dir, entry.name
+			if err := stage.Save(file, strings.NewReader(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stage.Len() != 2 {
+			t.Fatalf("Len = %d, want 2", stage.Len())
+		}
+		if _, err := os.Stat(filepath.Join(dir, "a.log")); !os.IsNotExist(err) {
+			t.Fatalf("staged file must not be renamed before commit, stat error: %v", err)
+		}
+		return stage
+	}
+
+	stageEntries().Rollback()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("rollback left %d files", len(entries))
+	}
+
+	var committed []string
+	err := stageEntries().Commit(func(file *files.File) {
+		committed = append(committed, file.Name)
+	})
+	if err != nil || len(committed) != 2 {
+		t.Fatalf("Commit = %v, committed %v", err, committed)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "a.log")); string(content) != "3" {
+		t.Errorf("a.log content %q, want the last entry", content)
+	}
+}
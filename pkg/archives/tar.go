@@ -0,0 +1,95 @@
+package archives
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+type Tar struct {
+	filter *memberFilter
+	open   opener // open returns the reader of the compressed tar stream, nil for a plain tar.
+}
+
+// extract extracts the regular files and the symbolic links of the archive which match the filter into
+// the directory of the archive and passes them to emit. Directories are created, hard links and special files
+// are skipped. The paths are resolved through the links extracted before, an entry or a link which resolves
+// outside of the directory of the archive rejects the archive.
+func (t *Tar) extract(file *files.File, r io.Reader, emit EmitFunc) (int, error) {
+	if t.open != nil {
+		stream, err := t.open(r)
+		if err != nil {
+			return 0, err
+		}
+		defer stream.Close()
+		r = stream
+	}
+
+	reader := tar.NewReader(r)
+	tree := newTree(file.Path)
+	var count int
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("tar reader error: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			name, err := entryName(file, header.Name)
+			if err != nil {
+				return count, err
+			}
+			resolved, err := tree.dir(name)
+			if err != nil {
+				return count, unsafeEntry(file, name, err)
+			}
+			if err = utils.CreatePath(filepath.Join(file.Path, filepath.FromSlash(resolved))); err != nil {
+				return count, err
+			}
+			continue
+		case tar.TypeReg, tar.TypeSymlink:
+		default:
+			continue
+		}
+		if !t.filter.match(header.Name) {
+			continue
+		}
+
+		name, err := entryName(file, header.Name)
+		if err != nil {
+			return count, err
+		}
+		var resolved string
+		if header.Typeflag == tar.TypeSymlink {
+			if resolved, err = tree.link(name, header.Linkname); err != nil {
+				return count, unsafeEntry(file, name, err)
+			}
+		} else if resolved, err = tree.file(name); err != nil {
+			return count, unsafeEntry(file, name, err)
+		}
+
+		entry, err := newEntry(file, resolved, header.Size, header.ModTime)
+		if err != nil {
+			return count, err
+		}
+		var content io.Reader = reader
+		if header.Typeflag == tar.TypeSymlink {
+			entry.Size = 0
+			entry.Link = header.Linkname
+			content = nil
+		}
+		if err = emit(entry, content); err != nil {
+			return count, fmt.Errorf("extract tar entry %s error: %w", header.Name, err)
+		}
+		count++
+	}
+}
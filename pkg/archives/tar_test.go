@@ -0,0 +1,114 @@
+package archives
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestTarDecompress(t *testing.T) {
+	modTime := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	headers := []*tar.Header{
+		{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "logs/app.log", Typeflag: tar.TypeReg, Size: 8, ModTime: modTime},
+		{Name: "logs/app.bin", Typeflag: tar.TypeReg, Size: 4, ModTime: modTime},
+		{Name: "logs/latest.log", Typeflag: tar.TypeSymlink, Linkname: "app.log", ModTime: modTime},
+	}
+	for _, header := range headers {
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compressed.Close()
+
+	dir := t.TempDir()
+	archive := &files.File{Key: "a/logs.tar.gz", ETag: "etag", Extension: ".tar.gz", Path: dir, Name: "logs.tar.gz", Data: files.NewBuffer()}
+	archive.Data.Write(buffer.Bytes())
+	stage := NewStage(archive, false)
+	if err := NewExtractor(&configuration.Configuration{Extension: "tar.gz,log"}).Extract(archive, stage); err != nil || stage.Len() != 2 {
+		t.Fatalf("Extract = %v, %d entries, want 2", err, stage.Len())
+	}
+
+	want := map[string]string{"logs/app.log": "", "logs/latest.log": "app.log"}
+	err := stage.Commit(func(entry *files.File) {
+		path, _ := filepath.Rel(dir, entry.LocalPath())
+		path = filepath.ToSlash(path)
+		if link, ok := want[path]; !ok || entry.Link != link {
+			t.Errorf("unexpected entry %s with link %q", path, entry.Link)
+		}
+		if content, _ := os.ReadFile(entry.LocalPath()); string(content) != "xxxxxxxx" {
+			t.Errorf("entry %s content %q", path, content)
+		}
+		delete(want, path)
+	})
+	if err != nil || len(want) > 0 {
+		t.Errorf("Commit = %v, missing entries %v", err, want)
+	}
+}
+
+func TestTarLinkChain(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	headers := []*tar.Header{
+		{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "a/b"},
+		{Name: "x/y", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "y/evil.txt", Typeflag: tar.TypeReg, Size: 4},
+	}
+	for _, header := range headers {
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archive := &files.File{Key: "chain.tar", Extension: ".tar", Path: filepath.Join(dir, "out"), Name: "chain.tar"}
+	stage := NewStage(archive, false)
+	_, err := NewExtractor(&configuration.Configuration{}).Stream(archive, &buffer, stage.Save)
+	if !errors.Is(err, ErrUnsafe) {
+		t.Fatalf("Stream error %v, want unsafe", err)
+	}
+	stage.Rollback()
+	if _, err = os.Lstat(filepath.Join(dir, "y")); !os.IsNotExist(err) {
+		t.Errorf("entry is written outside of the output directory: %v", err)
+	}
+	if entries, _ := os.ReadDir(archive.Path); len(entries) != 1 || entries[0].Name() != "a" {
+		t.Errorf("rejected archive left %v", entries)
+	}
+}
+
+func TestMemberFilter(t *testing.T) {
+	filter := newMemberFilter("zip,.tar.xz,tgz,csv", "Report")
+	for name, want := range map[string]bool{
+		"2023/report.csv":  true,
+		"2023/report.json": false,
+		"2023/summary.csv": false,
+	} {
+		if got := filter.match(name); got != want {
+			t.Errorf("match(%s) = %t, want %t", name, got, want)
+		}
+	}
+	if filter = newMemberFilter("zip", ""); !filter.match("any.bin") {
+		t.Errorf("filter with archive extensions only must match all members")
+	}
+}
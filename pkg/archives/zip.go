@@ -0,0 +1,100 @@
+package archives
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+type Zip struct {
+	filter *memberFilter
+}
+
+// extract extracts the entries of the archive which match the filter into the directory of the archive and
+// passes them to emit. Directories are created by the writers with the files, the modification times of
+// the entries are kept. An entry is rejected if its directory resolves outside through a symbolic link on
+// disk. An archive which is not in memory is spooled to a temporary file first.
+func (z *Zip) extract(file *files.File, r io.Reader, emit EmitFunc) (int, error) {
+	var readerAt io.ReaderAt
+	var size int64
+	if buffer, ok := r.(*bytes.Reader); ok {
+		readerAt, size = buffer, buffer.Size()
+	} else {
+		spooled, n, err := spool(file, r)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}()
+		readerAt, size = spooled, n
+	}
+
+	reader, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return 0, fmt.Errorf("zip reader error: %w", err)
+	}
+
+	tree := newTree(file.Path)
+	var count int
+	for _, zipFile := range reader.File {
+		if zipFile.FileInfo().IsDir() || !z.filter.match(zipFile.Name) {
+			continue
+		}
+		name, err := entryName(file, zipFile.Name)
+		if err != nil {
+			return count, err
+		}
+		resolved, err := tree.file(name)
+		if err != nil {
+			return count, unsafeEntry(file, name, err)
+		}
+		entry, err := newEntry(file, resolved, int64(zipFile.UncompressedSize64), zipFile.Modified)
+		if err != nil {
+			return count, err
+		}
+		if err = extractZipEntry(zipFile, entry, emit); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func extractZipEntry(zipFile *zip.File, entry *files.File, emit EmitFunc) error {
+	rc, err := zipFile.Open()
+	if err != nil {
+		entry.ReturnToPool()
+		return fmt.Errorf("open zip entry %s error: %w", zipFile.Name, err)
+	}
+	defer rc.Close()
+
+	if err = emit(entry, rc); err != nil {
+		return fmt.Errorf("extract zip entry %s error: %w", zipFile.Name, err)
+	}
+	return nil
+}
+
+// spool writes the archive to the temporary file next to it and returns the file and the size of the archive.
+func spool(file *files.File, r io.Reader) (*os.File, int64, error) {
+	if err := utils.CreatePath(file.Path); err != nil {
+		return nil, 0, err
+	}
+	spooled, err := os.OpenFile(file.TempPath(), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("spool archive %s error: %w", file.Name, err)
+	}
+	n, err := io.Copy(spooled, r)
+	if err != nil {
+		spooled.Close()
+		os.Remove(spooled.Name())
+		return nil, 0, fmt.Errorf("spool archive %s error: %w", file.Name, err)
+	}
+	return spooled, n, nil
+}
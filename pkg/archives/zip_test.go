@@ -0,0 +1,90 @@
+package archives
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestZipDecompress(t *testing.T) {
+	modTime := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range map[string]string{"report.csv": "a,b\n", "logs/app.log": "started\n"} {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	writer.Create("empty/")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archive := &files.File{Key: "a/drop.zip", ETag: "etag", Extension: ".zip", Path: dir, Name: "drop.zip", Data: files.NewBuffer()}
+	archive.Data.Write(buffer.Bytes())
+	stage := NewStage(archive, false)
+	if err := NewExtractor(&configuration.Configuration{}).Extract(archive, stage); err != nil || stage.Len() != 2 {
+		t.Fatalf("Extract = %v, %d entries, want 2", err, stage.Len())
+	}
+
+	want := map[string]string{"report.csv": "a,b\n", "logs/app.log": "started\n"}
+	err := stage.Commit(func(entry *files.File) {
+		path, _ := filepath.Rel(dir, entry.LocalPath())
+		path = filepath.ToSlash(path)
+		if content, _ := os.ReadFile(entry.LocalPath()); string(content) != want[path] {
+			t.Errorf("unexpected entry %s with content %q", path, content)
+		}
+		if !entry.ModTime.Equal(modTime) || entry.Key != archive.Key || entry.Archive != archive.LocalPath() {
+			t.Errorf("entry %s = %+v", path, entry)
+		}
+		delete(want, path)
+	})
+	if err != nil || len(want) > 0 {
+		t.Errorf("Commit = %v, missing entries %v", err, want)
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	archive := &files.File{Key: "drop.zip", Path: "/data/decompressed", Name: "drop.zip"}
+	for _, name := range []string{"../evil.sh", "/etc/passwd", "a/../../evil.sh"} {
+		if _, err := newEntry(archive, name, 0, time.Time{}); err == nil {
+			t.Errorf("newEntry(%q) expected error", name)
+		}
+	}
+}
+
+func TestStreamZip(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	w, _ := writer.Create("logs/app.log")
+	w.Write([]byte("started\n"))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archive := &files.File{Key: "drop.zip", Extension: ".zip", Path: dir, Name: "drop.zip"}
+	saved := make(map[string]string)
+	count, err := NewExtractor(&configuration.Configuration{}).Stream(archive, io.MultiReader(&buffer), func(file *files.File, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		rel, _ := filepath.Rel(dir, file.LocalPath())
+		saved[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil || count != 1 || saved["logs/app.log"] != "started\n" {
+		t.Fatalf("Stream = %d, %v, saved %v", count, err, saved)
+	}
+	if _, err = os.Stat(archive.TempPath()); !os.IsNotExist(err) {
+		t.Errorf("spooled archive must be removed, stat error: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cacher
+
+import (
+	"log"
+	"path"
+	"path/filepath"
+
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/statedb"
+)
+
+// archiveEntries are the local entries of an extracted multi-entry archive.
+type archiveEntries struct {
+	paths    []string // paths are the relative paths of the entries.
+	modified bool     // modified is set if an entry changed since it was extracted.
+}
+
+// addEntry records the entry of the archive found in the download directory. Entries are not cached as
+// files, the archive is cached instead, so entries are never handled as extraneous files on their own.
+func (c *FileCache) addEntry(archive, relPath string, trusted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, ok := c.archives[archive]
+	if !ok {
+		entries = &archiveEntries{}
+		c.archives[archive] = entries
+	}
+	entries.paths = append(entries.paths, relPath)
+	entries.modified = entries.modified || !trusted
+}
+
+// loadArchives caches the archives with entries in the download directory. An archive gets the ETag of its
+// object only if all entries are saved and not modified, otherwise it is downloaded and extracted again.
+// An archive without extracted entries, like an archive with no entry matching the filters, has no entries
+// to check, so it is trusted by its record.
+func (c *FileCache) loadArchives() {
+	for relPath, entries := range c.archives {
+		file := c.archiveFile(relPath)
+		if record, ok := c.store.Get(relPath); ok {
+			file.Size = record.ObjectSize
+			if record.Entries == len(entries.paths) && !entries.modified {
+				file.ETag = record.ETag
+			}
+		}
+		c.AddFile(relPath, file)
+	}
+
+	err := c.store.ForEach(func(record statedb.Record) error {
+		if !record.Extracted || record.Entries > 0 || !c.filter.Match(record.Key) {
+			return nil
+		}
+		if _, ok := c.archives[record.Path]; ok {
+			return nil
+		}
+		file := c.archiveFile(record.Path)
+		file.Size = record.ObjectSize
+		file.ETag = record.ETag
+		c.AddFile(record.Path, file)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Load archives error: %v\n", err)
+	}
+}
+
+// archiveFile returns the cached file of the archive with the relative path.
+func (c *FileCache) archiveFile(relPath string) *files.File {
+	file := files.NewFile()
+	file.Name = path.Base(relPath)
+	file.Path = filepath.Join(c.localPath, filepath.FromSlash(path.Dir(relPath)))
+	return file
+}
+
+// isArchiveEntry reports whether the file was extracted from an archive, so it is loaded regardless of the filters.
+func (c *FileCache) isArchiveEntry(path string) bool {
+	record, ok := c.store.Get(c.relativePath(path))
+	return ok && record.Archive != ""
+}
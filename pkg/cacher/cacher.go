@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
 	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/statedb"
 	"s3-crawler/pkg/utils"
 )
 
@@ -26,9 +28,30 @@ const status = "Loading and comparing cache"
 func (c *FileCache) LoadFromDir(cfg *configuration.Configuration) error {
 	c.printer.Send(fmt.Sprintf(status))
 	defer c.printer.Stop()
-	if _, err := os.Stat(cfg.LocalPath); os.IsNotExist(err) {
-		return nil
+	// A read-only cache, like the cache of a dry run before the first download, doesn't create the directory.
+	exists := true
+	if c.readOnly {
+		_, err := os.Stat(cfg.LocalPath)
+		exists = !os.IsNotExist(err)
+	} else if err := utils.CreatePath(cfg.LocalPath); err != nil {
+		return err
+	}
+	open := statedb.Open
+	if c.readOnly {
+		open = statedb.OpenReadOnly
+	}
+	store, err := open(cfg.LocalPath)
+	if err != nil {
+		return err
 	}
+	c.store = store
+	c.localPath = cfg.LocalPath
+	c.trashDir = cfg.Sync.TrashDir
+	c.minSize = cfg.GetMinFileSize()
+	c.maxSize = cfg.GetMaxFileSize()
+	c.after = cfg.GetModifiedAfter()
+	c.before = cfg.GetModifiedBefore()
+	c.filter = cfg.GetFilter()
 	start := time.Now()
 	numWorkers := cfg.NumCPU * 5
 	filesChan := make(chan string, numWorkers)
@@ -38,13 +61,24 @@ func (c *FileCache) LoadFromDir(cfg *configuration.Configuration) error {
 
 	var wg sync.WaitGroup
 	c.withParts = cfg.IsHashWithParts
+	c.withDirName = cfg.IsWithDirName
+	c.isCleaning = !c.readOnly && (cfg.Mode == configuration.ModeDownload || cfg.Mode == configuration.ModeSync)
 
+	c.found = make(map[string]struct{})
 	c.startWorkers(numWorkers, &wg, filesChan, chunkSize)
-	err := c.walkDir(cfg.LocalPath, nameMask, filesChan, extensions)
+	if exists {
+		err = c.walkDir(cfg.LocalPath, nameMask, filesChan, extensions)
+	}
 	close(filesChan)
 	wg.Wait()
+	c.loadArchives()
+	if err == nil {
+		c.pruneRecords()
+	}
+	c.found = nil
 
 	c.loadTime = time.Since(start)
+	c.loadedCount = c.totalCount
 	log.Print("Cache info: ", c)
 
 	return err
@@ -80,17 +114,50 @@ func (c *FileCache) processFile(path string, chunkSize int64) {
 	}
 
 	if !info.IsDir() {
-		etag, err := getHash(path, c.withParts, chunkSize)
-		if err != nil {
-			fmt.Printf("Error calculating ETag for file %s: %s\n", path, err.Error())
+		relPath := c.relativePath(path)
+		size := info.Size()
+		record, trusted := c.trustedHash(relPath, info, chunkSize)
+		etag, archive := record.ETag, record.Archive
+		if trusted {
+			if record.ObjectSize > 0 {
+				size = record.ObjectSize
+			}
+		} else {
+			etag, err = getHash(path, c.withParts, chunkSize)
+			if err != nil {
+				fmt.Printf("Error calculating ETag for file %s: %s\n", path, err.Error())
+				return
+			}
+			c.hashed.Add(1)
+			err = c.store.Put(statedb.Record{
+				Key:       record.Key,
+				ETag:      etag,
+				Size:      info.Size(),
+				ModTime:   info.ModTime().UnixNano(),
+				Path:      relPath,
+				Archive:   archive,
+				PartSize:  chunkSize,
+				WithParts: c.withParts,
+				Detected:  record.Detected,
+			})
+			if err != nil {
+				fmt.Printf("Error saving state of file %s: %s\n", path, err.Error())
+			}
+		}
+		if archive != "" {
+			c.addEntry(archive, relPath, trusted)
 			return
 		}
+		if record.Detected {
+			c.addDetected(relPath)
+		}
 
 		file := files.NewFile()
 		file.Name = info.Name()
+		file.Path = filepath.Dir(path)
 		file.ETag = etag
-		file.Size = info.Size()
-		c.AddFile(file.Name, file)
+		file.Size = size
+		c.AddFile(relPath, file)
 	}
 }
 
@@ -99,8 +166,25 @@ func (c *FileCache) walkDir(dir, nameMask string, filesChan chan string, extensi
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && c.trashDir != "" && path == c.trashDir {
+			return fs.SkipDir
+		}
 		if !d.IsDir() {
-			if c.isValidObject(path, nameMask, extensions) {
+			c.found[c.relativePath(path)] = struct{}{}
+			if d.Name() == statedb.FileName || d.Name() == statedb.CheckpointName {
+				return nil
+			}
+			// Partially downloaded files are resumed by the downloader, so they never match the cache.
+			if strings.HasSuffix(path, files.PartsSuffix) || isPartial(path) {
+				return nil
+			}
+			if strings.HasSuffix(path, files.TempSuffix) && !c.isTracked(path) {
+				if c.isCleaning {
+					c.removeStaleTemp(path)
+				}
+				return nil
+			}
+			if c.isValidObject(path, nameMask, extensions) && c.hasValidInfo(d) || c.isArchiveEntry(path) {
 				filesChan <- path
 			} else {
 				c.skipped++
@@ -110,13 +194,116 @@ func (c *FileCache) walkDir(dir, nameMask string, filesChan chan string, extensi
 	})
 }
 
+// trustedHash returns the record of the file saved in the state database and whether its hash is trusted:
+// the file size and modification time didn't change since the hash was recorded, and a hash calculated from
+// the local file was calculated with the same part size and parts setting. The key and the archive of the record
+// are kept even if the file was modified.
+func (c *FileCache) trustedHash(relPath string, info fs.FileInfo, chunkSize int64) (statedb.Record, bool) {
+	record, ok := c.store.Get(relPath)
+	if !ok || record.Size != info.Size() || record.ModTime != info.ModTime().UnixNano() {
+		return record, false
+	}
+	return record, record.PartSize == 0 || record.PartSize == chunkSize && record.WithParts == c.withParts
+}
+
+// pruneRecords removes the records of the files which are no longer in the download directory, like files
+// deleted by hand. The records of archives are kept while the archive is cached.
+func (c *FileCache) pruneRecords() {
+	removed, err := c.store.Prune(func(record statedb.Record) bool {
+		if _, ok := c.found[record.Path]; ok {
+			return true
+		}
+		_, cached := c.archives[record.Path]
+		return record.Extracted && (record.Entries == 0 || cached)
+	})
+	if err != nil {
+		log.Printf("Prune state database error: %v\n", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d stale record(s) from the state database.\n", removed)
+	}
+}
+
+// addDetected records the file decompressed from an object without an extension by the path the object has
+// without the decompression, so the object is looked up by the path of the decompressed file.
+func (c *FileCache) addDetected(relPath string) {
+	dir, name := path.Split(relPath)
+	dir = path.Dir(dir) // dir is the decompressed directory or the directory with the file name.
+	if c.withDirName {
+		dir = path.Dir(dir)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.detected[path.Join(path.Dir(dir), name)] = relPath
+}
+
+// relativePath returns the slash-separated path of the file relative to the download directory.
+func (c *FileCache) relativePath(path string) string {
+	relPath, err := filepath.Rel(c.localPath, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// isTracked reports whether the file has a record in the state database. Temporary files are never
+// recorded, so a tracked file with the temporary suffix is a file saved from an object with that name.
+func (c *FileCache) isTracked(path string) bool {
+	_, ok := c.store.Get(c.relativePath(path))
+	return ok
+}
+
+// removeStaleTemp removes the temporary file left by an interrupted write. The temporary file of a large
+// file with a sidecar is kept, so the downloader resumes it.
+func (c *FileCache) removeStaleTemp(path string) {
+	if isPartial(strings.TrimSuffix(path, files.TempSuffix)) {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error remove stale temporary file %s: %s\n", path, err.Error())
+		return
+	}
+	log.Printf("Removed stale temporary file %s.\n", path)
+}
+
+// isPartial reports whether the file has a sidecar with the parts of an unfinished download.
+func isPartial(path string) bool {
+	_, err := os.Stat(path + files.PartsSuffix)
+	return err == nil
+}
+
 func (c *FileCache) isValidObject(path, nameMask string, extensions []string) bool {
 	name := strings.ToLower(filepath.Base(path))
 
 	hasValidExt := utils.HasValidExtension(path, extensions)
 	hasValidName := utils.HasValidName(name, nameMask)
+	hasValidKey := c.filter.Match(c.objectKey(path))
+
+	return hasValidExt && hasValidName && hasValidKey
+}
 
-	return hasValidExt && hasValidName
+// objectKey returns the key of the object the file was saved from, so the filter rules match local files like
+// the objects even if the save path differs from the key: flattened names, decompressed files and versions.
+// The key is recorded in the state database, a file without the key is matched by its relative path.
+func (c *FileCache) objectKey(path string) string {
+	relPath := c.relativePath(path)
+	if record, ok := c.store.Get(relPath); ok && record.Key != "" {
+		return record.Key
+	}
+	return relPath
+}
+
+// hasValidInfo checks the file size and modification time filters. The file info is only requested
+// if the filters are set.
+func (c *FileCache) hasValidInfo(d fs.DirEntry) bool {
+	if c.minSize == 0 && c.maxSize == 0 && c.after.IsZero() && c.before.IsZero() {
+		return true
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	return utils.HasValidSize(info.Size(), c.minSize, c.maxSize) &&
+		utils.HasValidModTime(info.ModTime(), c.after, c.before)
 }
 
 var bufPool = sync.Pool{
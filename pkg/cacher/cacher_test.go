@@ -1,6 +1,7 @@
 package cacher
 
 import (
+	"context"
 	"crypto/md5"
 	rnd "crypto/rand"
 	"encoding/hex"
@@ -11,11 +12,15 @@ import (
 	"strconv"
 	"testing"
 
+	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/filter"
+	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/statedb"
 )
 
 const (
-	partSize    = files.ChunkSize
+	partSize    = 8 * files.MiB
 	numFiles    = 100
 	maxFileSize = 10 * files.MiB
 )
@@ -68,7 +73,7 @@ func TestGetFileMD5Hash(t *testing.T) {
 		expectedHashes[filePath] = hex.EncodeToString(hash[:]) + "-" + strconv.Itoa(parts)
 	}
 	for filePath, expectedHash := range expectedHashes {
-		hash, err := getHash(filePath, 0)
+		hash, err := getHash(filePath, true, partSize)
 		if err != nil {
 			t.Errorf("Error hasing data for file %s: %v", filePath, err)
 			continue
@@ -83,6 +88,168 @@ func TestGetFileMD5Hash(t *testing.T) {
 	}
 }
 
+func TestFilterByObjectKey(t *testing.T) {
+	dir := t.TempDir()
+	store, err := statedb.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	rules, err := filter.New([]string{"+ *.gz", "- **"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &FileCache{store: store, localPath: dir, filter: rules}
+	for _, record := range []statedb.Record{
+		{Key: "a/b/x.csv.gz", Path: "a_b_x.csv"},
+		{Key: "logs/app.log.gz", Path: "logs/decompressed/app.log"},
+		{Key: "logs/app.log", Path: "logs/app.log/3HL4kqtJlcpXroDTDmJ"},
+	} {
+		if err = store.Put(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for relPath, want := range map[string]bool{
+		"a_b_x.csv":                        true,
+		"logs/decompressed/app.log":        true,
+		"logs/app.log/3HL4kqtJlcpXroDTDmJ": false,
+		"untracked.gz":                     true,
+		"untracked.csv":                    false,
+	} {
+		if got := c.isValidObject(filepath.Join(dir, filepath.FromSlash(relPath)), "", nil); got != want {
+			t.Errorf("isValidObject(%s) = %t, want %t", relPath, got, want)
+		}
+	}
+}
+
+func TestLoadArchiveWithoutEntries(t *testing.T) {
+	dir := t.TempDir()
+	store, err := statedb.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	c := &FileCache{store: store, localPath: dir, Files: make(map[string]*files.File), archives: make(map[string]*archiveEntries)}
+	for _, record := range []statedb.Record{
+		{Key: "a/empty.zip", ETag: "empty", ObjectSize: 22, Path: "a/decompressed/empty.zip/empty.zip", Extracted: true},
+		{Key: "a/drop.zip", ETag: "drop", ObjectSize: 100, Path: "a/decompressed/drop.zip/drop.zip", Entries: 2, Extracted: true},
+	} {
+		if err = store.Put(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.addEntry("a/decompressed/drop.zip/drop.zip", "a/decompressed/drop.zip/report.csv", true)
+	c.loadArchives()
+
+	if !c.HasFile("a/decompressed/empty.zip/empty.zip", "empty", 22) {
+		t.Errorf("archive without entries must be trusted by its record")
+	}
+	if file, ok := c.GetFile("a/decompressed/drop.zip/drop.zip"); !ok || file.ETag != "" {
+		t.Errorf("archive with a missing entry must be cached without the ETag, got %+v", file)
+	}
+}
+
+func TestReadOnlyLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	c := &FileCache{
+		Files:    make(map[string]*files.File),
+		archives: make(map[string]*archiveEntries),
+		printer:  printprogress.NewStatusPrinter(context.Background(), 100, false),
+		readOnly: true,
+	}
+	if err := c.LoadFromDir(&configuration.Configuration{LocalPath: dir, NumCPU: 1}); err != nil {
+		t.Fatalf("LoadFromDir error: %v", err)
+	}
+	defer c.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("read-only load must not create the directory, stat error: %v", err)
+	}
+}
+
+func TestTrustedHash(t *testing.T) {
+	dir := t.TempDir()
+	store, err := statedb.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	path := filepath.Join(dir, "file.txt")
+	if err = os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	c := &FileCache{store: store, localPath: dir, withParts: true}
+
+	tests := []struct {
+		name    string
+		record  statedb.Record
+		trusted bool
+	}{
+		{name: "object etag", record: statedb.Record{ETag: "etag"}, trusted: true},
+		{name: "same settings", record: statedb.Record{ETag: "hash", PartSize: partSize, WithParts: true}, trusted: true},
+		{name: "other part size", record: statedb.Record{ETag: "hash", PartSize: 2 * partSize, WithParts: true}},
+		{name: "without parts", record: statedb.Record{ETag: "hash", PartSize: partSize}},
+	}
+	for _, test := range tests {
+		record := test.record
+		record.Path, record.Size, record.ModTime = "file.txt", info.Size(), info.ModTime().UnixNano()
+		store.Put(record)
+		if _, trusted := c.trustedHash("file.txt", info, partSize); trusted != test.trusted {
+			t.Errorf("%s: trusted %t, want %t", test.name, trusted, test.trusted)
+		}
+	}
+}
+
+func TestStaleTemp(t *testing.T) {
+	for _, mode := range []string{configuration.ModeDownload, configuration.ModeUpload} {
+		dir := t.TempDir()
+		userFile := filepath.Join(dir, "draft.part")
+		staleTemp := filepath.Join(dir, "report.csv"+files.TempSuffix)
+		for _, path := range []string{userFile, staleTemp} {
+			if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c := &FileCache{
+			Files:    make(map[string]*files.File),
+			archives: make(map[string]*archiveEntries),
+			detected: make(map[string]string),
+			printer:  printprogress.NewStatusPrinter(context.Background(), 100, false),
+		}
+		if err := c.LoadFromDir(&configuration.Configuration{LocalPath: dir, NumCPU: 1, Mode: mode}); err != nil {
+			t.Fatalf("%s: LoadFromDir error: %v", mode, err)
+		}
+		c.Close()
+
+		if _, err := os.Stat(userFile); err != nil {
+			t.Errorf("%s: the file of the user must be kept: %v", mode, err)
+		}
+		if _, err := os.Stat(staleTemp); os.IsNotExist(err) != (mode == configuration.ModeDownload) {
+			t.Errorf("%s: the stale temporary file must be removed only by the download mode, stat error: %v", mode, err)
+		}
+	}
+}
+
+func TestDetectedKey(t *testing.T) {
+	for _, withDirName := range []bool{false, true} {
+		c := &FileCache{localPath: "/data", detected: make(map[string]string), withDirName: withDirName}
+		decompressed := "a/decompressed/blob"
+		if withDirName {
+			decompressed = "a/decompressed/blob/blob"
+		}
+		c.addDetected(decompressed)
+
+		file := &files.File{Key: "a/blob", Path: "/data/a", Name: "blob"}
+		if got := c.Key(file); got != decompressed {
+			t.Errorf("Key of the object without an extension = %s, want %s", got, decompressed)
+		}
+		file.SetDetectedArchive(".gz", withDirName)
+		if got := c.Key(file); got != decompressed {
+			t.Errorf("Key of the detected archive = %s, want %s", got, decompressed)
+		}
+	}
+}
+
 /*func BenchmarkFileMD5Hash(b *testing.B) {
 	filePath := "/tmp/upload/data/newFolder_file_44780.html"
 
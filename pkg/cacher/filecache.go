@@ -3,25 +3,46 @@ package cacher
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/filter"
 	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/statedb"
 	"s3-crawler/pkg/utils"
 )
 
 type FileCache struct {
-	mu         sync.RWMutex
-	printer    *printprogress.Status
-	Files      map[string]*files.File
-	skipped    int
-	loadTime   time.Duration
-	totalSize  int64
-	totalCount uint32
-	withParts  bool
+	mu          sync.RWMutex
+	printer     *printprogress.Status
+	store       *statedb.Store // store persists hashes of local files between runs.
+	Files       map[string]*files.File
+	archives    map[string]*archiveEntries // archives are the entries of extracted archives by the archive path.
+	found       map[string]struct{}        // found are the relative paths of all files found while the cache is loaded.
+	detected    map[string]string          // detected are the paths of the files decompressed from objects without an extension by the paths of the objects.
+	localPath   string
+	trashDir    string // trashDir is excluded from the cache, it holds files removed by the sync mode.
+	skipped     int
+	minSize     int64
+	maxSize     int64
+	after       time.Time      // after is the lower bound of the modification time filter.
+	before      time.Time      // before is the upper bound of the modification time filter.
+	filter      *filter.Filter // filter is the include and exclude rules for the relative paths.
+	readOnly    bool           // readOnly specifies whether the local files are left untouched, like stale temporary files.
+	isCleaning  bool           // isCleaning is set if the stale temporary files are removed, only the download and sync modes write them.
+	hashed      atomic.Int64   // hashed is the number of files hashed because they are new or modified.
+	loadTime    time.Duration
+	totalSize   int64
+	totalCount  uint32
+	loadedCount uint32 // loadedCount is the number of files loaded from the directory.
+	withParts   bool
+	withDirName bool // withDirName is set if decompressed files are saved into a directory with the file name.
 }
 
 var fileCache *FileCache // fileCache is a pointer to the singleton instance of the FileCache structure.
@@ -31,8 +52,10 @@ var once sync.Once       // once is used to synchronize and ensure that objects
 func NewCache(ctx context.Context, cfg *configuration.Configuration) *FileCache {
 	once.Do(func() {
 		fileCache = &FileCache{
-			Files:   make(map[string]*files.File),
-			printer: printprogress.NewStatusPrinter(ctx, cfg.Progress.Delay, true),
+			Files:    make(map[string]*files.File),
+			archives: make(map[string]*archiveEntries),
+			detected: make(map[string]string),
+			printer:  printprogress.NewStatusPrinter(ctx, cfg.Progress.Delay, true),
 		}
 	})
 
@@ -56,6 +79,15 @@ func (c *FileCache) HasFile(key, etag string, size int64) bool {
 	return ok && cachedInfo.ETag == etag && cachedInfo.Size == size
 }
 
+// GetFile returns the cached file with the given key.
+func (c *FileCache) GetFile(key string) (*files.File, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	file, ok := c.Files[key]
+	return file, ok
+}
+
 func (c *FileCache) RemoveFile(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -79,6 +111,82 @@ func (c *FileCache) Clear() {
 	c.totalCount = 0
 }
 
+// SetReadOnly makes the loading leave the local files untouched, like stale temporary files. The state database
+// is opened read-only, so the hashes of new and modified files aren't recorded.
+func (c *FileCache) SetReadOnly() {
+	c.readOnly = true
+}
+
+// Key returns the cache key of the file: its save path relative to the download directory. An object without
+// an extension, which was decompressed because its data is compressed, has the path of the decompressed file.
+func (c *FileCache) Key(file *files.File) string {
+	relPath := c.relativePath(file.LocalPath())
+	if file.Extension == "" {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if decompressed, ok := c.detected[relPath]; ok {
+			return decompressed
+		}
+	}
+	return relPath
+}
+
+// Commit records the state of a file written to disk, so the next run trusts it without hashing.
+// The ETag and the size of the source object are recorded, so decompressed files are matched as well.
+func (c *FileCache) Commit(file *files.File) {
+	if c.store == nil {
+		return
+	}
+	path := file.LocalPath()
+	info, err := os.Lstat(path)
+	if err != nil {
+		log.Printf("Commit file %s error: %v\n", path, err)
+		return
+	}
+	record := statedb.Record{
+		Key:        file.Key,
+		ETag:       file.ETag,
+		Size:       info.Size(),
+		ObjectSize: file.Size,
+		ModTime:    info.ModTime().UnixNano(),
+		Path:       c.relativePath(path),
+		Detected:   file.IsArchive() && files.Ext(file.Key) == "",
+	}
+	if file.Archive != "" {
+		record.Archive = c.relativePath(file.Archive)
+	}
+	if err = c.store.Put(record); err != nil {
+		log.Printf("Commit file %s error: %v\n", path, err)
+	}
+}
+
+// CommitArchive records the extracted multi-entry archive. The archive is trusted by the next run only if
+// all its entries are saved and not modified, an archive without extracted entries is trusted by its record.
+func (c *FileCache) CommitArchive(archive *files.File, entries int) {
+	if c.store == nil {
+		return
+	}
+	err := c.store.Put(statedb.Record{
+		Key:        archive.Key,
+		ETag:       archive.ETag,
+		ObjectSize: archive.Size,
+		Path:       c.Key(archive),
+		Entries:    entries,
+		Extracted:  true,
+	})
+	if err != nil {
+		log.Printf("Commit archive %s error: %v\n", archive.LocalPath(), err)
+	}
+}
+
+// Close closes the state database.
+func (c *FileCache) Close() error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Close()
+}
+
 // String implements the fmt.Stringer interface and provides a custom string representation of the FileCache structure.
 func (c *FileCache) String() string {
 	c.mu.RLock()
@@ -86,7 +194,7 @@ func (c *FileCache) String() string {
 	var b strings.Builder
 	if c.totalCount > 0 {
 		// Total number of files in the cache
-		fmt.Fprintf(&b, "Data: [%d] file(s). Skipped [%d] file(s). ", c.totalCount, c.skipped)
+		fmt.Fprintf(&b, "Data: [%d] file(s). Skipped [%d] file(s). Hashed [%d] file(s). ", c.totalCount, c.skipped, c.hashed.Load())
 		// Total size of files in the cache
 		fmt.Fprintf(&b, "Total size: [%s]. ", utils.FormatBytes(c.totalSize))
 		// Load time of files in the cache
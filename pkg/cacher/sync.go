@@ -0,0 +1,117 @@
+package cacher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/utils"
+)
+
+// Sync handles local files which remain in the cache after the bucket listing, i.e. files whose
+// objects were deleted from the bucket. The files are reported, and deleted or moved to the trash
+// directory if it is enabled in the configuration. The run is aborted if the share of files to delete
+// exceeds the configured threshold.
+func (c *FileCache) Sync(cfg *configuration.Configuration) error {
+	extraneous := c.Keys(cfg.Prefix, cfg.IsFlattenName)
+	if len(extraneous) == 0 {
+		fmt.Printf("Sync: no extraneous local files found.\n")
+		return nil
+	}
+
+	for _, relPath := range extraneous {
+		fmt.Printf("Extraneous: %s\n", relPath)
+	}
+	// Without the loaded files the share is unknown, it is taken as 100%, so only the threshold of 100% allows deletion.
+	percent := 100.0
+	if c.loadedCount > 0 {
+		percent = float64(len(extraneous)) * 100 / float64(c.loadedCount)
+		fmt.Printf("Sync: %d of %d local file(s) (%.2f%%) are not present in the bucket.\n", len(extraneous), c.loadedCount, percent)
+	} else {
+		fmt.Printf("Sync: %d local file(s) are not present in the bucket.\n", len(extraneous))
+	}
+
+	if !cfg.Sync.Delete {
+		return nil
+	}
+	if cfg.Pagination.MaxPages > 0 {
+		log.Printf("Sync: listing is limited by maxPages, extraneous files are not deleted.\n")
+		return nil
+	}
+	if percent > cfg.Sync.MaxDeletePercent {
+		return fmt.Errorf("sync aborted: %.2f%% of local files would be deleted, threshold is %.2f%%", percent, cfg.Sync.MaxDeletePercent)
+	}
+
+	var removed int
+	for _, relPath := range extraneous {
+		if err := c.removeExtraneous(relPath, cfg.Sync.TrashDir); err != nil {
+			log.Printf("Sync: remove file %s error: %v\n", relPath, err)
+			continue
+		}
+		removed++
+	}
+	if cfg.Sync.TrashDir != "" {
+		fmt.Printf("Sync: moved %d file(s) to %s.\n", removed, cfg.Sync.TrashDir)
+	} else {
+		fmt.Printf("Sync: deleted %d file(s).\n", removed)
+	}
+	return nil
+}
+
+// Keys returns the sorted keys of the cached files which could be saved from objects with the prefix.
+func (c *FileCache) Keys(prefix string, isFlattenName bool) []string {
+	if isFlattenName {
+		prefix = strings.ReplaceAll(prefix, "/", "_")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]string, 0, len(c.Files))
+	for relPath := range c.Files {
+		if inPrefix(relPath, prefix) {
+			keys = append(keys, relPath)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// inPrefix reports whether the local file could be saved from an object with the given prefix.
+func inPrefix(relPath, prefix string) bool {
+	return strings.HasPrefix(relPath, prefix) ||
+		strings.HasPrefix(strings.TrimPrefix(relPath, files.DecompressedDir+"/"), prefix)
+}
+
+// removeExtraneous removes the extraneous file. The entries of an extracted archive are removed with it.
+func (c *FileCache) removeExtraneous(relPath, trashDir string) error {
+	if entries, ok := c.archives[relPath]; ok {
+		for _, entry := range entries.paths {
+			if err := c.removeFile(entry, trashDir); err != nil {
+				return err
+			}
+		}
+		return c.store.Delete(relPath)
+	}
+	return c.removeFile(relPath, trashDir)
+}
+
+func (c *FileCache) removeFile(relPath, trashDir string) error {
+	path := filepath.Join(c.localPath, filepath.FromSlash(relPath))
+	if trashDir != "" {
+		trashPath := filepath.Join(trashDir, filepath.FromSlash(relPath))
+		if err := utils.CreatePath(filepath.Dir(trashPath)); err != nil {
+			return err
+		}
+		if err := os.Rename(path, trashPath); err != nil {
+			return err
+		}
+	} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return c.store.Delete(relPath)
+}
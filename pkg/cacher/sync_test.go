@@ -0,0 +1,124 @@
+package cacher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/statedb"
+)
+
+func TestInPrefix(t *testing.T) {
+	tests := []struct {
+		relPath, prefix string
+		want            bool
+	}{
+		{relPath: "data/a.csv", prefix: "data/", want: true},
+		{relPath: "data2/a.csv", prefix: "data/", want: false},
+		{relPath: "data2/a.csv", prefix: "data", want: true},
+		{relPath: "decompressed/data/a.csv", prefix: "data/", want: true},
+		{relPath: "decompressed/data2/a.csv", prefix: "data/", want: false},
+		{relPath: "a.csv", prefix: "", want: true},
+	}
+	for _, test := range tests {
+		if got := inPrefix(test.relPath, test.prefix); got != test.want {
+			t.Errorf("inPrefix(%s, %q) = %t, want %t", test.relPath, test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := newSyncCache(t, "data/b.csv", "data/a.csv", "data2/a.csv", "data_flat.csv")
+	if got, want := c.Keys("data/", false), []string{"data/a.csv", "data/b.csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys = %v, want %v", got, want)
+	}
+	if got, want := c.Keys("data/", true), []string{"data_flat.csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys of flattened names = %v, want %v", got, want)
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name             string
+		delete           bool
+		maxDeletePercent float64
+		trashDir         string
+		wantErr          bool
+		wantKept         bool
+	}{
+		{name: "report only", maxDeletePercent: 100, wantKept: true},
+		{name: "threshold", delete: true, maxDeletePercent: 10, wantErr: true, wantKept: true},
+		{name: "remove", delete: true, maxDeletePercent: 50},
+		{name: "trash", delete: true, maxDeletePercent: 50, trashDir: "trash"},
+	}
+	for _, test := range tests {
+		// Two of the four loaded files are not present in the bucket.
+		c := newSyncCache(t, "data/a.csv", "data/b.csv")
+		c.loadedCount = 4
+		cfg := &configuration.Configuration{Prefix: "data/"}
+		cfg.Sync.Delete = test.delete
+		cfg.Sync.MaxDeletePercent = test.maxDeletePercent
+		if test.trashDir != "" {
+			cfg.Sync.TrashDir = filepath.Join(c.localPath, test.trashDir)
+		}
+
+		if err := c.Sync(cfg); (err != nil) != test.wantErr {
+			t.Errorf("%s: Sync error = %v, want error %t", test.name, err, test.wantErr)
+		}
+		for _, relPath := range []string{"data/a.csv", "data/b.csv"} {
+			_, err := os.Stat(filepath.Join(c.localPath, relPath))
+			if kept := err == nil; kept != test.wantKept {
+				t.Errorf("%s: %s kept %t, want %t", test.name, relPath, kept, test.wantKept)
+			}
+			_, recorded := c.store.Get(relPath)
+			if recorded != test.wantKept {
+				t.Errorf("%s: %s recorded %t, want %t", test.name, relPath, recorded, test.wantKept)
+			}
+			if test.trashDir == "" {
+				continue
+			}
+			if _, err = os.Stat(filepath.Join(cfg.Sync.TrashDir, relPath)); err != nil {
+				t.Errorf("%s: %s must be moved to the trash: %v", test.name, relPath, err)
+			}
+		}
+	}
+}
+
+func TestSyncWithoutLoadedFiles(t *testing.T) {
+	c := newSyncCache(t, "data/a.csv")
+	cfg := &configuration.Configuration{}
+	cfg.Sync.Delete = true
+	cfg.Sync.MaxDeletePercent = 50
+	if err := c.Sync(cfg); err == nil {
+		t.Errorf("files must not be deleted when the share of extraneous files is unknown")
+	}
+}
+
+// newSyncCache returns the cache of the files with the relative paths, which are written to a temporary
+// directory and recorded in the state database.
+func newSyncCache(t *testing.T, relPaths ...string) *FileCache {
+	dir := t.TempDir()
+	store, err := statedb.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	c := &FileCache{store: store, localPath: dir, Files: make(map[string]*files.File)}
+	for _, relPath := range relPaths {
+		path := filepath.Join(dir, filepath.FromSlash(relPath))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte(relPath), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.Put(statedb.Record{Key: relPath, Path: relPath}); err != nil {
+			t.Fatal(err)
+		}
+		c.Files[relPath] = &files.File{Key: relPath}
+	}
+	return c
+}
@@ -3,12 +3,17 @@ package configuration
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/filter"
+	"s3-crawler/pkg/retry"
 	"s3-crawler/pkg/utils"
 )
 
@@ -21,31 +26,88 @@ const (
 	defaultDelay   = 1000 * time.Millisecond
 	defaultBarSize = 20
 
-	defaultMaxKeys = 1000
-	ChunkSizeMB    = 8 * files.MiB
+	defaultMaxKeys     = 1000
+	defaultListWorkers = 16
+	ChunkSizeMB        = 8 * files.MiB
 
 	defaultPath = "/tmp/crawler"
+
+	defaultMaxDeletePercent = 10
+
+	defaultUploaders       = 16
+	defaultPartConcurrency = 5
+
+	defaultDownloadPartConcurrency = 8
+
+	defaultFailedRetries   = 3
+	defaultFailedBackoffMs = 1000
+
+	defaultRetryAttempts      = 5
+	defaultRetryBaseBackoffMs = 200
+	defaultRetryMaxBackoffMs  = 20000
+	defaultRetryJitter        = 0.5
+	defaultRetryTimeoutMs     = 30000
+
+	defaultStreamThresholdMB = 64
+	defaultMaxExpansionRatio = 200
+	defaultMaxArchiveTotalMB = 10 * 1024
+	defaultMaxArchiveEntries = 100000
+)
+
+const (
+	ModeDownload = "download" // ModeDownload downloads new and changed files from the bucket.
+	ModeSync     = "sync"     // ModeSync downloads like ModeDownload and handles local files missing in the bucket.
+	ModeUpload   = "upload"   // ModeUpload uploads new and changed local files to the bucket.
+	ModeMirror   = "mirror"   // ModeMirror copies new and changed objects to the destination bucket.
+)
+
+const (
+	VersionsAsOf = "asOf" // VersionsAsOf downloads the latest versions of objects as of the given time.
+	VersionsAll  = "all"  // VersionsAll downloads all versions of objects into key/<versionId>.
 )
 
 // Configuration holds settings for connecting to S3 and downloading files.
 type Configuration struct {
-	S3Connection    S3ConnectionConfig `json:"s3Connection"`
-	BucketName      string             `json:"bucketName"`              // BucketName is the name of the S3 bucket.
-	Prefix          string             `json:"s3prefix,omitempty"`      // Prefix is the prefix for files in the S3 bucket.
-	Extension       string             `json:"extensions,omitempty"`    // Extension is the file extension to filter by.
-	NameMask        string             `json:"nameMask,omitempty"`      // NameMask is a mask for filtering file names.
-	LocalPath       string             `json:"downloadPath"`            // LocalPath is the local path to download files to.
-	MaxFileSize     uint64             `json:"maxFileSizeMB,omitempty"` // MaxFileSize is the maximum file size in MB.
-	MinFileSize     uint64             `json:"minFileSizeMB,omitempty"` // MinFileSize is the minimum file size in MB.
-	Pagination      PaginationConfig   `json:"pagination"`
-	Downloaders     uint16             `json:"downloaders,omitempty"`  // Downloaders is the maximum number of concurrent goroutines for downloading files.
-	NumCPU          uint8              `json:"numCPU,omitempty"`       // NumCPU controls the distribution of load on processor cores.
-	IsDecompress    bool               `json:"decompress,omitempty"`   // IsDecompress specifies whether to decompress downloaded files.
-	IsWithDirName   bool               `json:"decompressWithDirName"`  // IsWithDirName specifies whether to include directory names in downloaded file paths.
-	IsSaveArchives  bool               `json:"saveArchives,omitempty"` // IsSaveArchives specifies whether to delete downloaded files after decompression.
-	IsHashWithParts bool               `json:"withParts"`              // IsHashWithParts specifies whether to include parts in hash calculation.
-	IsFlattenName   bool               `json:"isFlattenName"`
-	Progress        Progress           `json:"progress,omitempty"`
+	S3Connection      S3ConnectionConfig `json:"s3Connection"`
+	BucketName        string             `json:"bucketName"`                // BucketName is the name of the S3 bucket.
+	Prefix            string             `json:"s3prefix,omitempty"`        // Prefix is the prefix for files in the S3 bucket.
+	Extension         string             `json:"extensions,omitempty"`      // Extension is the file extension to filter by.
+	NameMask          string             `json:"nameMask,omitempty"`        // NameMask is a mask for filtering file names.
+	LocalPath         string             `json:"downloadPath"`              // LocalPath is the local path to download files to.
+	MaxFileSize       uint64             `json:"maxFileSizeMB,omitempty"`   // MaxFileSize is the maximum file size in MB.
+	MinFileSize       uint64             `json:"minFileSizeMB,omitempty"`   // MinFileSize is the minimum file size in MB.
+	ModifiedAfter     string             `json:"modifiedAfter,omitempty"`   // ModifiedAfter filters files modified at or after the RFC3339 time or the duration ago, like 24h.
+	ModifiedBefore    string             `json:"modifiedBefore,omitempty"`  // ModifiedBefore filters files modified before the RFC3339 time or the duration ago.
+	Filters           []string           `json:"filters,omitempty"`         // Filters is the ordered list of include "+ pattern" and exclude "- pattern" rules for keys.
+	FiltersFile       string             `json:"filtersFile,omitempty"`     // FiltersFile is the file with rules applied after the Filters, one rule per line.
+	ModTimeMetadata   string             `json:"modTimeMetadata,omitempty"` // ModTimeMetadata is the user metadata key with the original modification time, like mtime.
+	Pagination        PaginationConfig   `json:"pagination"`
+	Downloaders       uint16             `json:"downloaders,omitempty"`  // Downloaders is the maximum number of concurrent goroutines for downloading files.
+	NumCPU            uint8              `json:"numCPU,omitempty"`       // NumCPU controls the distribution of load on processor cores.
+	IsDecompress      bool               `json:"decompress,omitempty"`   // IsDecompress specifies whether to decompress downloaded files.
+	IsWithDirName     bool               `json:"decompressWithDirName"`  // IsWithDirName specifies whether to include directory names in downloaded file paths.
+	IsSaveArchives    bool               `json:"saveArchives,omitempty"` // IsSaveArchives specifies whether to delete downloaded files after decompression.
+	IsHashWithParts   bool               `json:"withParts"`              // IsHashWithParts specifies whether to include parts in hash calculation.
+	IsFlattenName     bool               `json:"isFlattenName"`
+	IsFsync           bool               `json:"fsync,omitempty"`           // IsFsync specifies whether to flush files to disk before they are renamed into place.
+	IsVerifyIntegrity bool               `json:"verifyIntegrity,omitempty"` // IsVerifyIntegrity specifies whether to verify downloaded data by the ETag and additional checksums.
+	PartConcurrency   int                `json:"partConcurrency,omitempty"` // PartConcurrency is the maximum number of parts of a single file downloaded concurrently.
+	Progress          Progress           `json:"progress,omitempty"`
+	Mode              string             `json:"mode,omitempty"`    // Mode is the run mode: download (default), sync, upload or mirror.
+	Timeout           string             `json:"timeout,omitempty"` // Timeout is the timeout of the whole run, like 2h. Empty or 0 means no timeout.
+	Sync              SyncConfig         `json:"sync,omitempty"`
+	Upload            UploadConfig       `json:"upload,omitempty"`
+	Destination       DestinationConfig  `json:"destination,omitempty"`
+	Versions          VersionsConfig     `json:"versions,omitempty"`
+	Failures          FailuresConfig     `json:"failures,omitempty"`
+	Retry             RetryConfig        `json:"retry,omitempty"`
+	Bandwidth         BandwidthConfig    `json:"bandwidth,omitempty"`
+	Archives          ArchivesConfig     `json:"archives,omitempty"`
+	modifiedAfter     time.Time
+	modifiedBefore    time.Time
+	filter            *filter.Filter
+	retryPolicy       *retry.Policy
+	timeout           time.Duration
 }
 
 // S3ConnectionConfig holds settings for connecting to S3.
@@ -63,6 +125,10 @@ type PaginationConfig struct {
 	ChunkSize int64  `json:"chunkSizeMB,omitempty"`
 	MaxPages  uint16 `json:"maxPages,omitempty"` // MaxPages is the maximum number of pages to retrieve.
 	MaxKeys   uint16 `json:"maxKeys,omitempty"`  // MaxKeys is the maximum number of keys per page.
+	// FanOutDepth is the depth of common prefixes discovered with the "/" delimiter before listing them concurrently.
+	// Zero disables the fan-out and the bucket is listed by a single paginator.
+	FanOutDepth uint8  `json:"fanOutDepth,omitempty"`
+	ListWorkers uint16 `json:"listWorkers,omitempty"` // ListWorkers is the maximum number of prefixes listed concurrently.
 }
 
 // Progress holds settings for progress reporting.
@@ -72,6 +138,103 @@ type Progress struct {
 	WithProgressBar bool          `json:"withProgressBar,omitempty"` // WithProgressBar specifies whether to display a progress bar.
 }
 
+// SyncConfig holds settings for local files which are not present in the bucket.
+type SyncConfig struct {
+	Delete           bool    `json:"delete,omitempty"`           // Delete specifies whether to delete extraneous local files, otherwise they are only reported.
+	TrashDir         string  `json:"trashDir,omitempty"`         // TrashDir is the directory to move extraneous files to instead of deleting them.
+	MaxDeletePercent float64 `json:"maxDeletePercent,omitempty"` // MaxDeletePercent aborts the run if more than N% of local files would be deleted.
+}
+
+// UploadConfig holds settings for the upload mode.
+type UploadConfig struct {
+	Uploaders       uint16 `json:"uploaders,omitempty"`       // Uploaders is the maximum number of files uploaded concurrently.
+	PartConcurrency int    `json:"partConcurrency,omitempty"` // PartConcurrency is the number of parts of a single file uploaded concurrently.
+}
+
+// DestinationConfig holds settings of the destination bucket for the mirror mode.
+type DestinationConfig struct {
+	S3Connection S3ConnectionConfig `json:"s3Connection"`       // S3Connection is the destination connection, the source connection is used if the endpoint is empty.
+	BucketName   string             `json:"bucketName"`         // BucketName is the name of the destination bucket.
+	Prefix       string             `json:"s3prefix,omitempty"` // Prefix replaces the source prefix in the destination keys.
+}
+
+// IsSameEndpoint reports whether the source and the destination buckets are accessible
+// by the same endpoint and credentials, so objects can be copied on the server side.
+func (config *Configuration) IsSameEndpoint() bool {
+	return config.Destination.S3Connection == config.S3Connection
+}
+
+// FailuresConfig holds settings for retrying the files which failed to download.
+type FailuresConfig struct {
+	MaxRetries int    `json:"maxRetries,omitempty"` // MaxRetries is the number of rounds the failed files are downloaded again after the run.
+	Backoff    uint32 `json:"backoffMs,omitempty"`  // Backoff is the delay in milliseconds before the first round, it is doubled for each next round.
+}
+
+// GetBackoff returns the delay before the first retry round.
+func (failures FailuresConfig) GetBackoff() time.Duration {
+	return time.Duration(failures.Backoff) * time.Millisecond
+}
+
+// RetryConfig holds settings for retrying failed requests to S3.
+type RetryConfig struct {
+	MaxAttempts int     `json:"maxAttempts,omitempty"`   // MaxAttempts is the number of attempts of a request including the first one.
+	BaseBackoff uint32  `json:"baseBackoffMs,omitempty"` // BaseBackoff is the delay in milliseconds before the first retry, it is doubled for each next retry.
+	MaxBackoff  uint32  `json:"maxBackoffMs,omitempty"`  // MaxBackoff is the maximum delay in milliseconds between attempts.
+	Jitter      float64 `json:"jitter,omitempty"`        // Jitter is the random part of the delay from 0 to 1.
+	Timeout     uint32  `json:"timeoutMs,omitempty"`     // Timeout is the timeout in milliseconds of a listing or HEAD request, zero means no timeout.
+}
+
+func (retryConfig RetryConfig) policy() *retry.Policy {
+	return &retry.Policy{
+		MaxAttempts: retryConfig.MaxAttempts,
+		BaseBackoff: time.Duration(retryConfig.BaseBackoff) * time.Millisecond,
+		MaxBackoff:  time.Duration(retryConfig.MaxBackoff) * time.Millisecond,
+		Jitter:      retryConfig.Jitter,
+		Timeout:     time.Duration(retryConfig.Timeout) * time.Millisecond,
+	}
+}
+
+// BandwidthConfig holds settings for limiting the download bandwidth.
+type BandwidthConfig struct {
+	Limit       float64 `json:"limitMBps,omitempty"`   // Limit is the maximum download rate of all files in MB per second, zero means no limit.
+	ControlAddr string  `json:"controlAddr,omitempty"` // ControlAddr is the address of the HTTP endpoint to change the limit at runtime, like localhost:8090.
+}
+
+// GetLimit returns the maximum download rate in bytes per second, zero if there is no limit.
+func (bandwidth BandwidthConfig) GetLimit() int64 {
+	if bandwidth.Limit <= 0 {
+		return 0
+	}
+	return int64(bandwidth.Limit * files.MiB)
+}
+
+// ArchivesConfig holds settings for decompressing archives.
+type ArchivesConfig struct {
+	// StreamThreshold is the size in MB above which archives are decompressed on the fly from the download
+	// straight to disk instead of in memory. Zero means archives are always decompressed in memory.
+	StreamThreshold uint64  `json:"streamThresholdMB,omitempty"`
+	MaxRatio        float64 `json:"maxExpansionRatio,omitempty"` // MaxRatio is the maximum ratio of the extracted size of an archive to its size, zero means no limit.
+	MaxTotal        uint64  `json:"maxTotalMB,omitempty"`        // MaxTotal is the maximum extracted size of an archive in MB, zero means no limit.
+	MaxEntries      int     `json:"maxEntries,omitempty"`        // MaxEntries is the maximum number of entries extracted from an archive, zero means no limit.
+}
+
+// GetStreamThreshold returns the size in bytes above which archives are decompressed on the fly, zero if they aren't.
+func (archives ArchivesConfig) GetStreamThreshold() int64 {
+	return int64(archives.StreamThreshold * files.MiB)
+}
+
+// GetMaxTotal returns the maximum extracted size of an archive in bytes, zero if there is no limit.
+func (archives ArchivesConfig) GetMaxTotal() int64 {
+	return int64(archives.MaxTotal * files.MiB)
+}
+
+// VersionsConfig holds settings for downloading versions of objects from a versioned bucket.
+type VersionsConfig struct {
+	Mode string `json:"mode,omitempty"` // Mode is asOf or all. Empty mode downloads the current objects.
+	AsOf string `json:"asOf,omitempty"` // AsOf is the point in time in RFC3339 format or the duration ago for the asOf mode.
+	asOf time.Time
+}
+
 func NewConfiguration() *Configuration {
 	return &Configuration{
 		LocalPath: defaultPath,
@@ -83,6 +246,27 @@ func NewConfiguration() *Configuration {
 			Delay:   defaultDelay,
 			BarSize: defaultBarSize,
 		},
+		Mode: ModeDownload,
+		Sync: SyncConfig{
+			MaxDeletePercent: defaultMaxDeletePercent,
+		},
+		Failures: FailuresConfig{
+			MaxRetries: defaultFailedRetries,
+			Backoff:    defaultFailedBackoffMs,
+		},
+		Retry: RetryConfig{
+			MaxAttempts: defaultRetryAttempts,
+			BaseBackoff: defaultRetryBaseBackoffMs,
+			MaxBackoff:  defaultRetryMaxBackoffMs,
+			Jitter:      defaultRetryJitter,
+			Timeout:     defaultRetryTimeoutMs,
+		},
+		Archives: ArchivesConfig{
+			StreamThreshold: defaultStreamThresholdMB,
+			MaxRatio:        defaultMaxExpansionRatio,
+			MaxTotal:        defaultMaxArchiveTotalMB,
+			MaxEntries:      defaultMaxArchiveEntries,
+		},
 	}
 }
 
@@ -111,12 +295,41 @@ func LoadConfig(filename string) (*Configuration, error) {
 	if cfg.Pagination.MaxKeys <= 0 {
 		cfg.Pagination.MaxKeys = defaultMaxKeys
 	}
+	if cfg.Pagination.FanOutDepth > 0 && cfg.Pagination.ListWorkers == 0 {
+		cfg.Pagination.ListWorkers = defaultListWorkers
+		log.Printf("ListWorkers value not provided, using default value: %d.\n", cfg.Pagination.ListWorkers)
+	}
 	if cfg.NumCPU <= 0 {
 		cfg.NumCPU = uint8(runtime.NumCPU())
 		log.Printf("Invalid value of NumCPU provided, using default value: %d.\n", cfg.NumCPU)
 	}
 	cfg.validateDownloaders()
+	if cfg.PartConcurrency <= 0 {
+		cfg.PartConcurrency = defaultDownloadPartConcurrency
+	}
 	cfg.validateChunkSize()
+	if err = cfg.validateMode(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateVersions(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateModTime(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateFilters(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateRetry(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateTimeout(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateArchives(); err != nil {
+		return nil, err
+	}
+	cfg.ModTimeMetadata = strings.TrimPrefix(strings.ToLower(cfg.ModTimeMetadata), "x-amz-meta-")
 
 	log.Printf("Load config, elapsed: %s.\n", time.Since(start).Truncate(time.Millisecond))
 
@@ -175,6 +388,166 @@ func (config *Configuration) validateS3creds() error {
 	return nil
 }
 
+func (config *Configuration) validateMode() error {
+	// The trash directory is excluded from the local files in every mode, so it is never uploaded.
+	if config.Sync.TrashDir != "" && !filepath.IsAbs(config.Sync.TrashDir) {
+		config.Sync.TrashDir = filepath.Join(config.LocalPath, config.Sync.TrashDir)
+	}
+	switch config.Mode {
+	case "":
+		config.Mode = ModeDownload
+	case ModeDownload:
+	case ModeSync:
+		if config.Sync.MaxDeletePercent <= 0 || config.Sync.MaxDeletePercent > 100 {
+			config.Sync.MaxDeletePercent = defaultMaxDeletePercent
+			log.Printf("Invalid value of MaxDeletePercent provided, using default value: %.0f%%.\n", config.Sync.MaxDeletePercent)
+		}
+	case ModeMirror:
+		if config.Destination.BucketName == "" {
+			return errors.New("destination bucketName must be provided")
+		}
+		if config.Destination.S3Connection.Endpoint == "" {
+			config.Destination.S3Connection = config.S3Connection
+			log.Printf("Destination endpoint is not provided, using source connection.\n")
+		}
+		if config.Upload.PartConcurrency <= 0 {
+			config.Upload.PartConcurrency = defaultPartConcurrency
+		}
+	case ModeUpload:
+		if config.Upload.Uploaders == 0 {
+			config.Upload.Uploaders = defaultUploaders
+			log.Printf("Uploaders value not provided, using default value: %d.\n", config.Upload.Uploaders)
+		}
+		if config.Upload.PartConcurrency <= 0 {
+			config.Upload.PartConcurrency = defaultPartConcurrency
+		}
+		// Files are uploaded by parts, so the local hashes must be multipart ETags to match the uploaded objects.
+		if !config.IsHashWithParts {
+			config.IsHashWithParts = true
+			log.Printf("Upload mode compares multipart ETags, withParts is enabled.\n")
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", config.Mode)
+	}
+	return nil
+}
+
+func (config *Configuration) validateVersions() error {
+	switch config.Versions.Mode {
+	case "", VersionsAll:
+	case VersionsAsOf:
+		if config.Versions.AsOf == "" {
+			return errors.New("versions asOf must be provided")
+		}
+		asOf, err := utils.ParseTime(config.Versions.AsOf, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid versions asOf value: %w", err)
+		}
+		config.Versions.asOf = asOf
+	default:
+		return fmt.Errorf("unknown versions mode: %s", config.Versions.Mode)
+	}
+	return nil
+}
+
+func (config *Configuration) validateModTime() error {
+	now := time.Now()
+	var err error
+	if config.modifiedAfter, err = utils.ParseTime(config.ModifiedAfter, now); err != nil {
+		return fmt.Errorf("invalid modifiedAfter value: %w", err)
+	}
+	if config.modifiedBefore, err = utils.ParseTime(config.ModifiedBefore, now); err != nil {
+		return fmt.Errorf("invalid modifiedBefore value: %w", err)
+	}
+	if !config.modifiedAfter.IsZero() && !config.modifiedBefore.IsZero() && !config.modifiedAfter.Before(config.modifiedBefore) {
+		return errors.New("modifiedAfter must be before modifiedBefore")
+	}
+	return nil
+}
+
+func (config *Configuration) validateFilters() error {
+	rules := config.Filters
+	if config.FiltersFile != "" {
+		lines, err := filter.ReadFile(config.FiltersFile)
+		if err != nil {
+			return err
+		}
+		rules = append(append([]string{}, rules...), lines...)
+	}
+	var err error
+	if config.filter, err = filter.New(rules); err != nil {
+		return fmt.Errorf("invalid filters: %w", err)
+	}
+	return nil
+}
+
+func (config *Configuration) validateRetry() error {
+	if config.Retry.Jitter < 0 || config.Retry.Jitter > 1 {
+		return fmt.Errorf("invalid retry jitter %v, must be from 0 to 1", config.Retry.Jitter)
+	}
+	if config.Retry.MaxAttempts <= 0 {
+		config.Retry.MaxAttempts = 1
+		log.Printf("Invalid value of retry maxAttempts provided, requests are not retried.\n")
+	}
+	config.retryPolicy = config.Retry.policy()
+	return nil
+}
+
+func (config *Configuration) validateArchives() error {
+	if config.Archives.MaxRatio < 0 {
+		return fmt.Errorf("invalid archives maxExpansionRatio %v, must not be negative", config.Archives.MaxRatio)
+	}
+	if config.Archives.MaxEntries < 0 {
+		return fmt.Errorf("invalid archives maxEntries %d, must not be negative", config.Archives.MaxEntries)
+	}
+	return nil
+}
+
+func (config *Configuration) validateTimeout() error {
+	if config.Timeout == "" || config.Timeout == "0" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(config.Timeout)
+	if err != nil || timeout < 0 {
+		return fmt.Errorf("invalid timeout value: %s", config.Timeout)
+	}
+	config.timeout = timeout
+	return nil
+}
+
+// GetTimeout returns the timeout of the whole run, zero if the run is not limited.
+func (config *Configuration) GetTimeout() time.Duration {
+	return config.timeout
+}
+
+// GetRetryPolicy returns the policy for retrying failed requests to S3.
+func (config *Configuration) GetRetryPolicy() *retry.Policy {
+	if config.retryPolicy == nil {
+		return config.Retry.policy()
+	}
+	return config.retryPolicy
+}
+
+// GetFilter returns the compiled include and exclude rules, nil if there are no rules.
+func (config *Configuration) GetFilter() *filter.Filter {
+	return config.filter
+}
+
+// GetModifiedAfter returns the lower bound of the modification time filter, zero if not set.
+func (config *Configuration) GetModifiedAfter() time.Time {
+	return config.modifiedAfter
+}
+
+// GetModifiedBefore returns the upper bound of the modification time filter, zero if not set.
+func (config *Configuration) GetModifiedBefore() time.Time {
+	return config.modifiedBefore
+}
+
+// GetVersionsAsOf returns the point in time of the asOf versions mode.
+func (config *Configuration) GetVersionsAsOf() time.Time {
+	return config.Versions.asOf
+}
+
 func (config *Configuration) validateDownloaders() {
 	switch {
 	case config.Downloaders == 0:
@@ -200,6 +573,15 @@ func (config *Configuration) validateChunkSize() {
 		log.Printf("ChunkSizeMB value is provided, using value: %s.\n", utils.FormatBytes(config.Pagination.ChunkSize))
 	}
 }
+
+// GetPartConcurrency returns the maximum number of parts of a single file downloaded concurrently.
+func (config *Configuration) GetPartConcurrency() int {
+	if config.PartConcurrency <= 0 {
+		return defaultDownloadPartConcurrency
+	}
+	return config.PartConcurrency
+}
+
 func (config *Configuration) GetChunkSize() int64 {
 	return config.Pagination.ChunkSize
 }
@@ -1,36 +1,46 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"s3-crawler/pkg/archives"
+	"s3-crawler/pkg/cacher"
 	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
 	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/ratelimit"
+	"s3-crawler/pkg/retry"
 	"s3-crawler/pkg/s3client"
 	"s3-crawler/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go/logging"
 )
 
-const maxRetries = 3
+// maxPartBodyRetries is the number of retries of reading a part body by the manager after a broken connection.
+const maxPartBodyRetries = 3
 
 type Downloader struct {
 	cfg *configuration.Configuration
 	*s3client.Client
+	cache               *cacher.FileCache
 	smallFileDownloader *manager.Downloader
 	printer             printprogress.ProgressPrinter
+	retry               *retry.Policy       // retry is the policy for HEAD and GET requests.
+	limiter             *ratelimit.Limiter  // limiter is the bandwidth limit of all downloads, nil if it isn't configured.
+	extractor           *archives.Extractor // extractor decompresses the archives streamed straight to disk.
 	wg                  sync.WaitGroup
 	activeFiles         atomic.Int32
 }
@@ -38,123 +48,427 @@ type Downloader struct {
 var downloader *Downloader
 var once sync.Once
 
-func NewDownloader(client *s3client.Client, cfg *configuration.Configuration) *Downloader {
+func NewDownloader(client *s3client.Client, cfg *configuration.Configuration, cache *cacher.FileCache) *Downloader {
 	once.Do(func() {
 		downloader = &Downloader{
-			Client:  client,
-			cfg:     cfg,
-			wg:      sync.WaitGroup{},
-			printer: printprogress.NewPrinter(cfg),
+			Client:    client,
+			cfg:       cfg,
+			cache:     cache,
+			wg:        sync.WaitGroup{},
+			printer:   printprogress.NewPrinter(cfg),
+			retry:     cfg.GetRetryPolicy(),
+			extractor: archives.NewExtractor(cfg),
 			smallFileDownloader: manager.NewDownloader(client, func(d *manager.Downloader) {
 				d.BufferProvider = manager.NewPooledBufferedWriterReadFromProvider(files.Buffer32KB)
 				d.LogInterruptedDownloads = true
 				d.PartBodyMaxRetries = 0
-
+				d.ClientOptions = append(d.ClientOptions, s3client.DisableRetries)
 			}),
 		}
+		if cfg.Bandwidth.GetLimit() > 0 || cfg.Bandwidth.ControlAddr != "" {
+			downloader.limiter = ratelimit.New(cfg.Bandwidth.GetLimit())
+		}
 	})
 	return downloader
 }
 
+// Limiter returns the bandwidth limiter of the downloads, nil if the limit isn't configured.
+func (downloader *Downloader) Limiter() *ratelimit.Limiter {
+	return downloader.limiter
+}
+
+// limit returns the writer limited by the bandwidth limiter if it is configured.
+func (downloader *Downloader) limit(ctx context.Context, w io.WriterAt) io.WriterAt {
+	if downloader.limiter == nil {
+		return w
+	}
+	return &limitedWriterAt{ctx: ctx, writer: w, limiter: downloader.limiter}
+}
+
+// DownloadFiles downloads the files from the DownloadChan until it is closed by the listing. Failed files
+// are downloaded again with an exponential backoff, files which still fail are left in the failures of the data.
 func (downloader *Downloader) DownloadFiles(ctx context.Context, data *files.FileCollection) (time.Duration, error) {
 	start := time.Now()
-	workers := downloader.cfg.GetDownloaders()
 
 	go downloader.printer.StartProgressTicker(ctx, data, start, &downloader.activeFiles)
 
+	downloader.runWorkers(ctx, data.DownloadChan, data)
+	downloader.retryFailed(ctx, data)
+	close(data.ArchivesChan)
+
+	elapsed := time.Since(start)
+	_, downloadedCount, _, bytes, _, averageSpeed, _ := data.GetStatistics(elapsed)
+	failed := len(data.Failures())
+	// clear line
+	fmt.Print("\u001B[2K\r")
+	if data.Count() > 0 {
+		result := fmt.Sprintf("Downloaded %d file(s) in %s. Total filesize: %s. ", downloadedCount, elapsed.Truncate(time.Millisecond), utils.FormatBytes(bytes))
+		if failed > 0 {
+			result += fmt.Sprintf("Failed %d file(s). ", failed)
+		}
+		if pending := len(data.Pending()); pending > 0 {
+			result += fmt.Sprintf("Stopped before %d pending file(s). ", pending)
+		}
+		result += fmt.Sprintf("Average download speed = %s/s\n", utils.FormatBytes(int64(averageSpeed)))
+		fmt.Print(result)
+	} else {
+		fmt.Printf("Nothing to download. Exit...\n")
+	}
+	return elapsed, nil
+}
+
+// runWorkers downloads the files from the channel until it is closed. Failed files are recorded in the data.
+// After the data is stopped or ctx is done, the remaining files are recorded as pending.
+func (downloader *Downloader) runWorkers(ctx context.Context, filesChan <-chan *files.File, data *files.FileCollection) {
+	workers := downloader.cfg.GetDownloaders()
 	for i := 0; i < workers; i++ {
 		downloader.wg.Add(1)
 		go func() {
 			defer downloader.wg.Done()
-			for fileData := range data.DownloadChan {
+			for fileData := range filesChan {
+				if data.IsStopped() || ctx.Err() != nil {
+					data.AddPending(fileData)
+					fileData.ReturnToPool()
+					continue
+				}
 				err := downloader.downloadFile(ctx, fileData, data)
-				if err != nil {
+				switch {
+				case errors.Is(err, archives.ErrUnsafe):
+					log.Printf("Unsafe archive: %v\n", err)
+					data.AddViolation(fileData, err, false)
+				case err != nil:
 					log.Printf("Download error: %v", err)
-					continue
+					data.MarkAsFailed(fileData, err, true)
 				}
 			}
 		}()
 	}
-
-	data.GetDataToDownload()
-	close(data.DownloadChan)
-
 	downloader.wg.Wait()
-	close(data.ArchivesChan)
+}
 
-	elapsed := time.Since(start)
-	_, _, _, bytes, _, averageSpeed, _ := data.GetStatistics(elapsed)
-	// clear line
-	fmt.Print("\u001B[2K\r")
-	if data.Count() > 0 {
-		result := fmt.Sprintf("Downloaded %d file(s) in %s. Total filesize: %s. ", data.Count(), elapsed.Truncate(time.Millisecond), utils.FormatBytes(bytes))
-		result += fmt.Sprintf("Average download speed = %s/s\n", utils.FormatBytes(int64(averageSpeed)))
-		fmt.Print(result)
-	} else {
-		fmt.Printf("Nothing to download. Exit...\n")
+// retryFailed downloads the failed files again up to the configured number of rounds. The delay before
+// each round is doubled.
+func (downloader *Downloader) retryFailed(ctx context.Context, data *files.FileCollection) {
+	backoff := downloader.cfg.Failures.GetBackoff()
+	for round := 1; round <= downloader.cfg.Failures.MaxRetries; round++ {
+		if data.IsStopped() || ctx.Err() != nil {
+			return
+		}
+		retry := data.TakeRetryable()
+		if len(retry) == 0 {
+			return
+		}
+		log.Printf("Retry %d failed file(s) in %s (round %d of %d).\n", len(retry), backoff, round, downloader.cfg.Failures.MaxRetries)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		filesChan := make(chan *files.File, len(retry))
+		for _, fileData := range retry {
+			filesChan <- fileData
+		}
+		close(filesChan)
+		downloader.runWorkers(ctx, filesChan, data)
+		backoff *= 2
 	}
-	return elapsed, nil
 }
 
 func (downloader *Downloader) downloadFile(ctx context.Context, fileData *files.File, data *files.FileCollection) error {
 	downloader.activeFiles.Add(1)
 	defer downloader.activeFiles.Add(-1)
-	defer data.MarkAsDownloaded(fileData)
 
-	if fileData.IsSmallFile || fileData.IsArchive() {
-		fileData.Data = files.NewBuffer()
-		fileData.Data.Grow(int(fileData.Size))
-		pw := NewProgressWriterAt(fileData.Data, fileData.Size, func(n int64) {
-			data.UpdateProgress(n)
-		})
+	expected, err := downloader.inspectObject(ctx, fileData)
+	if err != nil {
+		return fmt.Errorf("head object %s error: %w", fileData.Key, err)
+	}
+	if err = downloader.detectArchive(ctx, fileData); err != nil {
+		return err
+	}
 
-		if err := downloader.download(ctx, fileData, pw); err != nil {
-			return fmt.Errorf("download file %s error: %w", fileData.Name, err)
+	// Data which doesn't match the hashes of the object and requests failed by a temporary reason are
+	// downloaded again. Completed parts of a file downloaded to disk are kept, so only the missing parts
+	// are requested by the next attempt.
+	for attempt := 1; ; attempt++ {
+		switch {
+		case downloader.isStreamed(fileData):
+			err = downloader.downloadStream(ctx, fileData, data, expected)
+		case fileData.IsSmallFile || downloader.isDecompressed(fileData):
+			err = downloader.downloadToMemory(ctx, fileData, data, expected)
+		default:
+			err = downloader.downloadToDisk(ctx, fileData, data, expected)
+		}
+		retryable := errors.Is(err, errIntegrity) || retry.IsRetryable(err)
+		if err == nil || !retryable || attempt >= downloader.retry.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		delay := downloader.retry.Backoff(attempt)
+		log.Printf("Download file %s error: %v. Retry in %s (attempt %d of %d).\n",
+			fileData.Key, err, delay.Truncate(time.Millisecond), attempt+1, downloader.retry.MaxAttempts)
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return err
 		}
+	}
+}
 
-		if numBytes := pw.(*progressWriterAt).BytesWritten(); numBytes != int(fileData.Size) {
-			return fmt.Errorf("written bytes not equal fileData size")
+// downloadToMemory downloads the file to a buffer and passes it to the decompressors or the writers.
+func (downloader *Downloader) downloadToMemory(ctx context.Context, fileData *files.File, data *files.FileCollection, expected *integrity) (err error) {
+	fileData.Data = files.NewBuffer()
+	fileData.Data.Grow(int(fileData.Size))
+	pw := NewProgressWriterAt(fileData.Data, fileData.Size, func(n int64) {
+		data.UpdateProgress(n)
+	})
+	defer func() {
+		// The file is downloaded again by a retry, so its progress is rolled back.
+		if err != nil {
+			data.UpdateProgress(-int64(pw.(*progressWriterAt).BytesWritten()))
 		}
+	}()
+	var w io.WriterAt = pw
+	var hw *hashingWriterAt
+	if expected != nil {
+		hw = newHashingWriterAt(pw, expected)
+		w = hw
+	}
+	w = downloader.limit(ctx, w)
+
+	if err = downloader.download(ctx, fileData, w); err != nil {
+		return fmt.Errorf("download file %s error: %w", fileData.Name, err)
+	}
 
-		if downloader.cfg.IsDecompress && fileData.IsArchive() && archives.IsSupportedArchive(fileData.Extension) {
-			data.ArchivesChan <- fileData
-		} else {
-			data.DataChan <- fileData
+	if numBytes := pw.(*progressWriterAt).BytesWritten(); numBytes != int(fileData.Size) {
+		return fmt.Errorf("written bytes not equal fileData size")
+	}
+	if hw != nil {
+		if err = hw.verify(bytes.NewReader(fileData.Data.Bytes()), fileData.Size); err != nil {
+			fileData.Data.Reset()
+			return fmt.Errorf("file %s: %w", fileData.Name, err)
 		}
+	}
+
+	data.MarkAsDownloaded(fileData)
+	if downloader.isDecompressed(fileData) {
+		data.ArchivesChan <- fileData
 	} else {
-		if err := utils.CreatePath(fileData.Path); err != nil {
-			return fmt.Errorf("create folder %s error: %w", fileData.Path, err)
+		data.DataChan <- fileData
+	}
+	return nil
+}
+
+// isDecompressed reports whether the file is an archive of a supported format decompressed by the run. Only
+// these archives are downloaded in memory regardless of their size, other files are routed by the size.
+func (downloader *Downloader) isDecompressed(fileData *files.File) bool {
+	return downloader.cfg.IsDecompress && fileData.IsArchive() && archives.IsSupportedArchive(fileData.Extension)
+}
+
+// detectArchive requests the first bytes of the object without an extension if the decompression is enabled.
+// If the data is compressed by a registered single-stream codec, the file gets the extension of the codec, so it is
+// decompressed and saved into the decompressed directory like a file with the extension, regardless of its size.
+func (downloader *Downloader) detectArchive(ctx context.Context, fileData *files.File) error {
+	if !downloader.cfg.IsDecompress || fileData.Extension != "" || fileData.Size == 0 {
+		return nil
+	}
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(downloader.cfg.BucketName),
+		Key:     aws.String(fileData.Key),
+		Range:   aws.String(fmt.Sprintf("bytes=0-%d", archives.HeadSize-1)),
+		IfMatch: aws.String("\"" + fileData.ETag + "\""),
+	}
+	if fileData.VersionID != "" {
+		input.VersionId = aws.String(fileData.VersionID)
+	}
+	var head []byte
+	err := downloader.retry.Do(ctx, func(reqCtx context.Context) error {
+		output, err := downloader.GetObject(reqCtx, input, s3client.DisableRetries)
+		if err != nil {
+			return err
 		}
-		file, err := os.OpenFile(filepath.Join(fileData.Path, fileData.Name), os.O_CREATE|os.O_WRONLY, os.ModePerm)
+		defer output.Body.Close()
+		head, err = io.ReadAll(output.Body)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("detect format of %s error: %w", fileData.Key, err)
+	}
+	if ext := archives.Detect(head); ext != "" {
+		fileData.SetDetectedArchive(ext, downloader.cfg.IsWithDirName)
+	}
+	return nil
+}
+
+// downloadToDisk writes the file directly to disk. Files with several parts are downloaded by ranged
+// requests and the completed parts are recorded in a sidecar, so an interrupted download resumes
+// only the missing byte ranges on the next run.
+func (downloader *Downloader) downloadToDisk(ctx context.Context, fileData *files.File, data *files.FileCollection, expected *integrity) (err error) {
+	if err := utils.CreatePath(fileData.Path); err != nil {
+		return fmt.Errorf("create folder %s error: %w", fileData.Path, err)
+	}
+	filePath := fileData.LocalPath()
+	tmpPath := fileData.TempPath()
+	chunkSize := downloader.cfg.GetChunkSize()
+	parts := downloader.getDownloadParts(fileData.Size, chunkSize)
+
+	var state *partsState
+	flags := os.O_CREATE | os.O_RDWR | os.O_TRUNC
+	if parts > 1 {
+		state = loadPartsState(filePath, fileData, chunkSize, parts)
+		if _, err := os.Stat(tmpPath); err != nil {
+			// The parts recorded in the sidecar are lost with the temporary file.
+			state.reset()
+		}
+		if state.completedBytes() > 0 {
+			flags = os.O_CREATE | os.O_RDWR
+		}
+	}
+
+	file, err := os.OpenFile(tmpPath, flags, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("create file %s error: %w", fileData.Name, err)
+	}
+	if state != nil {
+		state.file = file
+	}
+	pw := NewProgressWriterAt(file, fileData.Size, func(n int64) {
+		data.UpdateProgress(n)
+	}).(*progressWriterAt)
+	pw.keepPartial = state != nil
+	defer func() {
+		// The file is downloaded again by a retry, so its progress is rolled back. Resumed parts are
+		// accounted again when the download is resumed.
 		if err != nil {
-			return fmt.Errorf("create file %s error: %w", fileData.Name, err)
-		}
-		defer file.Close()
-		pw := NewProgressWriterAt(file, fileData.Size, func(n int64) {
-			data.UpdateProgress(n)
-		})
-		defer func(at *progressWriterAt) {
-			err = at.Close()
-			if err != nil {
-				log.Println(err)
+			data.UpdateProgress(-int64(pw.BytesWritten()))
+		}
+	}()
+
+	err = downloader.writeToDisk(ctx, fileData, file, pw, state, expected)
+	// The file is closed once. An incomplete file is removed by Close, unless its parts are kept to resume it.
+	if closeErr := pw.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("close file %s error: %w", fileData.Name, closeErr)
+	}
+	if errors.Is(err, errIntegrity) {
+		// The corrupted part is unknown, so the whole file is downloaded again.
+		if state != nil {
+			state.remove()
+		}
+		os.Remove(tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err = utils.RenameFile(tmpPath, filePath, fileData.ModTime); err != nil {
+		return fmt.Errorf("file %s: %w", fileData.Name, err)
+	}
+	if state != nil {
+		state.remove()
+	}
+	downloader.cache.Commit(fileData)
+	data.MarkAsDownloaded(fileData)
+	return nil
+}
+
+// writeToDisk downloads the file or its missing parts to the open temporary file, verifies the data and
+// flushes it to disk if fsync is enabled. The file is closed by the caller.
+func (downloader *Downloader) writeToDisk(ctx context.Context, fileData *files.File, file *os.File, pw *progressWriterAt, state *partsState, expected *integrity) error {
+	var w io.WriterAt = pw
+	var hw *hashingWriterAt
+	if expected != nil {
+		hw = newHashingWriterAt(pw, expected)
+		w = hw
+	}
+	w = downloader.limit(ctx, w)
+
+	if state == nil {
+		if err := downloader.download(ctx, fileData, w); err != nil {
+			return fmt.Errorf("download file %s error: %w", fileData.Name, err)
+		}
+	} else {
+		if resumed := state.completedBytes(); resumed > 0 {
+			log.Printf("Resume download of %s from %s.\n", fileData.Key, utils.FormatBytes(resumed))
+			pw.resume(resumed)
+		}
+		if err := downloader.downloadParts(ctx, fileData, w, state); err != nil {
+			if isObjectChanged(err) {
+				state.remove()
 			}
-		}(pw.(*progressWriterAt))
-		if err = downloader.download(ctx, fileData, pw); err != nil {
 			return fmt.Errorf("download file %s error: %w", fileData.Name, err)
 		}
+	}
 
-		if actualSize := pw.(*progressWriterAt).BytesWritten(); actualSize != int(fileData.Size) {
-			return fmt.Errorf("written bytes not equal file size")
+	if actualSize := pw.BytesWritten(); actualSize != int(fileData.Size) {
+		return fmt.Errorf("written bytes not equal file size")
+	}
+	if hw != nil {
+		if err := hw.verify(file, fileData.Size); err != nil {
+			return fmt.Errorf("file %s: %w", fileData.Name, err)
+		}
+	}
+	if downloader.cfg.IsFsync {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("sync file %s error: %w", fileData.Name, err)
 		}
 	}
 	return nil
 }
 
+// downloadParts downloads the missing parts of the file concurrently. Each request is conditional on
+// the ETag of the object, so data from another object version is never mixed into the file.
+func (downloader *Downloader) downloadParts(ctx context.Context, fileData *files.File, w io.WriterAt, state *partsState) error {
+	missing := state.missingParts()
+	partDownloader := downloader.createDownloader(fileData.Size, state.PartSize)
+
+	partsChan := make(chan int, len(missing))
+	for _, part := range missing {
+		partsChan <- part
+	}
+	close(partsChan)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for i := 0; i < partDownloader.Concurrency && i < len(missing); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range partsChan {
+				start, end := state.partRange(part)
+				input := &s3.GetObjectInput{
+					Bucket:  aws.String(downloader.cfg.BucketName),
+					Key:     aws.String(fileData.Key),
+					Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					IfMatch: aws.String("\"" + fileData.ETag + "\""),
+				}
+				if fileData.VersionID != "" {
+					input.VersionId = aws.String(fileData.VersionID)
+				}
+				_, err := partDownloader.Download(ctx, io.NewOffsetWriter(w, start), input)
+				if err == nil {
+					err = state.complete(part)
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
 func (downloader *Downloader) download(ctx context.Context, fileData *files.File, w io.WriterAt) error {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(downloader.cfg.BucketName),
 		Key:    aws.String(fileData.Key),
 	}
+	if fileData.VersionID != "" {
+		input.VersionId = aws.String(fileData.VersionID)
+	}
 
 	chunkSize := downloader.cfg.GetChunkSize()
 
@@ -174,17 +488,81 @@ func (downloader *Downloader) download(ctx context.Context, fileData *files.File
 	return nil
 }
 
+// inspectObject requests the object metadata if the modification time metadata key is configured or the
+// integrity verification is enabled. It returns the expected hashes of the object, nil if the verification
+// is disabled. The request for the first part returns the part size of a multipart object.
+func (downloader *Downloader) inspectObject(ctx context.Context, fileData *files.File) (*integrity, error) {
+	verify := downloader.cfg.IsVerifyIntegrity
+	if downloader.cfg.ModTimeMetadata == "" && !verify {
+		return nil, nil
+	}
+	input := &s3.HeadObjectInput{
+		Bucket:  aws.String(downloader.cfg.BucketName),
+		Key:     aws.String(fileData.Key),
+		IfMatch: aws.String("\"" + fileData.ETag + "\""),
+	}
+	if fileData.VersionID != "" {
+		input.VersionId = aws.String(fileData.VersionID)
+	}
+	if verify {
+		input.PartNumber = 1
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	var head *s3.HeadObjectOutput
+	err := downloader.retry.Do(ctx, func(reqCtx context.Context) error {
+		var err error
+		head, err = downloader.HeadObject(reqCtx, input, s3client.DisableRetries)
+		return err
+	})
+	if err != nil {
+		if verify {
+			return nil, err
+		}
+		log.Printf("Modification time of %s error: %v. Using LastModified.\n", fileData.Key, err)
+		return nil, nil
+	}
+	if err = downloader.resolveModTime(fileData, head.Metadata); err != nil {
+		log.Printf("Modification time of %s error: %v. Using LastModified.\n", fileData.Key, err)
+	}
+	if !verify {
+		return nil, nil
+	}
+	return newIntegrity(fileData, head), nil
+}
+
+// resolveModTime replaces the LastModified of the file with the modification time from the user metadata
+// of the object if the metadata key is configured and the object has it.
+func (downloader *Downloader) resolveModTime(fileData *files.File, metadata map[string]string) error {
+	if downloader.cfg.ModTimeMetadata == "" {
+		return nil
+	}
+	value, ok := metadata[downloader.cfg.ModTimeMetadata]
+	if !ok {
+		return nil
+	}
+	modTime, err := utils.ParseModTime(value)
+	if err != nil {
+		return err
+	}
+	fileData.ModTime = modTime
+	return nil
+}
+
 func (downloader *Downloader) createDownloader(fileSize int64, chuckSize int64) *manager.Downloader {
 	newDownloader := manager.NewDownloader(downloader, func(d *manager.Downloader) {
 		d.Logger = logging.NewStandardLogger(os.Stdout)
+		d.ClientOptions = append(d.ClientOptions, s3client.DisableRetries)
 	})
 
 	parts := downloader.getDownloadParts(fileSize, chuckSize)
 
 	newDownloader.PartSize = chuckSize
 	newDownloader.Concurrency = parts
+	if partConcurrency := downloader.cfg.GetPartConcurrency(); parts > partConcurrency {
+		newDownloader.Concurrency = partConcurrency
+	}
 	newDownloader.BufferProvider = manager.NewPooledBufferedWriterReadFromProvider(files.MiB)
-	newDownloader.PartBodyMaxRetries = maxRetries
+	newDownloader.PartBodyMaxRetries = maxPartBodyRetries
 
 	return newDownloader
 }
@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestIsDecompressed(t *testing.T) {
+	tests := []struct {
+		key          string
+		isDecompress bool
+		want         bool
+	}{
+		{key: "a/logs.tar", isDecompress: true, want: true},
+		{key: "a/report.csv.gz", isDecompress: true, want: true},
+		{key: "a/report.csv", isDecompress: true, want: false},
+		// Without the decompression a large archive is downloaded to disk like any other file.
+		{key: "a/logs.tar", want: false},
+		{key: "a/drop.zip", want: false},
+	}
+	for _, test := range tests {
+		downloader := &Downloader{cfg: &configuration.Configuration{IsDecompress: test.isDecompress}}
+		file := &files.File{Key: test.key, Extension: files.Ext(test.key), Size: 1024 * files.MiB}
+		if got := downloader.isDecompressed(file); got != test.want {
+			t.Errorf("isDecompressed(%s) with decompress %t = %t, want %t", test.key, test.isDecompress, got, test.want)
+		}
+	}
+}
+
+func TestCreateDownloaderConcurrency(t *testing.T) {
+	downloader := &Downloader{cfg: &configuration.Configuration{PartConcurrency: 4}}
+	if got := downloader.createDownloader(100*1024*files.MiB, 8*files.MiB).Concurrency; got != 4 {
+		t.Errorf("Concurrency of a large file = %d, want the part concurrency 4", got)
+	}
+	if got := downloader.createDownloader(20*files.MiB, 8*files.MiB).Concurrency; got != 3 {
+		t.Errorf("Concurrency of a file with 3 parts = %d, want 3", got)
+	}
+}
@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"s3-crawler/pkg/files"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// errIntegrity is returned when the downloaded data doesn't match the ETag or a checksum of the object.
+var errIntegrity = errors.New("integrity check failed")
+
+// integrity holds the expected ETag and additional checksums of the object.
+type integrity struct {
+	etag      string                             // etag is the MD5 or the multipart ETag, empty if it isn't a hash of the data.
+	partSize  int64                              // partSize is the size of the parts of a multipart ETag.
+	checksums map[types.ChecksumAlgorithm]string // checksums are the base64 encoded additional checksums.
+}
+
+// newIntegrity returns the expected hashes of the object from the HeadObject response for the first part.
+// ETags of objects encrypted with SSE-KMS or SSE-C are not MD5, so they are not compared. Checksums of
+// multipart objects are checksums of the part checksums, so only the multipart ETag is compared for them.
+func newIntegrity(fileData *files.File, head *s3.HeadObjectOutput) *integrity {
+	expected := &integrity{checksums: make(map[types.ChecksumAlgorithm]string)}
+	encrypted := head.SSECustomerAlgorithm != nil ||
+		head.ServerSideEncryption == types.ServerSideEncryptionAwsKms ||
+		head.ServerSideEncryption == types.ServerSideEncryptionAwsKmsDsse
+
+	_, partsCount, multipart := strings.Cut(fileData.ETag, "-")
+	if multipart {
+		if _, err := strconv.Atoi(partsCount); err == nil && !encrypted && head.ContentLength > 0 {
+			expected.etag = fileData.ETag
+			expected.partSize = head.ContentLength
+		}
+		return expected
+	}
+	if !encrypted {
+		expected.etag = fileData.ETag
+	}
+
+	for algorithm, value := range map[types.ChecksumAlgorithm]*string{
+		types.ChecksumAlgorithmCrc32:  head.ChecksumCRC32,
+		types.ChecksumAlgorithmCrc32c: head.ChecksumCRC32C,
+		types.ChecksumAlgorithmSha1:   head.ChecksumSHA1,
+		types.ChecksumAlgorithmSha256: head.ChecksumSHA256,
+	} {
+		if value != nil && *value != "" && !strings.Contains(*value, "-") {
+			expected.checksums[algorithm] = *value
+		}
+	}
+	return expected
+}
+
+// digest calculates the ETag and the additional checksums of the data written to it.
+type digest struct {
+	partSize  int64
+	part      hash.Hash // part is the MD5 of the current part, or of the whole data if partSize is zero.
+	partLen   int64
+	partSums  []byte
+	parts     int
+	checksums map[types.ChecksumAlgorithm]hash.Hash
+}
+
+func newDigest(expected *integrity) *digest {
+	d := &digest{
+		partSize:  expected.partSize,
+		checksums: make(map[types.ChecksumAlgorithm]hash.Hash, len(expected.checksums)),
+	}
+	if expected.etag != "" {
+		d.part = md5.New()
+	}
+	for algorithm := range expected.checksums {
+		switch algorithm {
+		case types.ChecksumAlgorithmCrc32:
+			d.checksums[algorithm] = crc32.NewIEEE()
+		case types.ChecksumAlgorithmCrc32c:
+			d.checksums[algorithm] = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+		case types.ChecksumAlgorithmSha1:
+			d.checksums[algorithm] = sha1.New()
+		case types.ChecksumAlgorithmSha256:
+			d.checksums[algorithm] = sha256.New()
+		}
+	}
+	return d
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	for _, h := range d.checksums {
+		h.Write(p)
+	}
+	if d.part == nil {
+		return len(p), nil
+	}
+	written := len(p)
+	for len(p) > 0 {
+		n := int64(len(p))
+		if d.partSize > 0 && n > d.partSize-d.partLen {
+			n = d.partSize - d.partLen
+		}
+		d.part.Write(p[:n])
+		d.partLen += n
+		p = p[n:]
+		if d.partSize > 0 && d.partLen == d.partSize {
+			d.finishPart()
+		}
+	}
+	return written, nil
+}
+
+func (d *digest) finishPart() {
+	d.partSums = d.part.Sum(d.partSums)
+	d.parts++
+	d.part.Reset()
+	d.partLen = 0
+}
+
+// etag returns the MD5 of the data, or the MD5 of the part MD5s with the parts count for a multipart ETag.
+func (d *digest) etag() string {
+	if d.partSize == 0 {
+		return hex.EncodeToString(d.part.Sum(nil))
+	}
+	if d.partLen > 0 {
+		d.finishPart()
+	}
+	sum := md5.Sum(d.partSums)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(d.parts)
+}
+
+// check compares the hashes of the data with the expected ones.
+func (d *digest) check(expected *integrity) error {
+	if expected.etag != "" {
+		if actual := d.etag(); actual != expected.etag {
+			return fmt.Errorf("%w: ETag %s, expected %s", errIntegrity, actual, expected.etag)
+		}
+	}
+	for algorithm, h := range d.checksums {
+		actual := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		if actual != expected.checksums[algorithm] {
+			return fmt.Errorf("%w: %s %s, expected %s", errIntegrity, algorithm, actual, expected.checksums[algorithm])
+		}
+	}
+	return nil
+}
+
+// hashingWriterAt hashes the data while it is written. Only data written in order is hashed, after data
+// written out of order, like parts downloaded concurrently or resumed, the data is hashed by reading it back.
+type hashingWriterAt struct {
+	writer   io.WriterAt
+	expected *integrity
+	digest   *digest
+	next     int64
+	inOrder  bool
+	mu       sync.Mutex
+}
+
+func newHashingWriterAt(writer io.WriterAt, expected *integrity) *hashingWriterAt {
+	return &hashingWriterAt{
+		writer:   writer,
+		expected: expected,
+		digest:   newDigest(expected),
+		inOrder:  true,
+	}
+}
+
+func (hw *hashingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := hw.writer.WriteAt(p, off)
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.inOrder && off == hw.next {
+		hw.digest.Write(p[:n])
+		hw.next += int64(n)
+	} else if n > 0 {
+		hw.inOrder = false
+	}
+	return n, err
+}
+
+// verify checks the data of the given size. If the data wasn't hashed while it was written, it is read from r.
+func (hw *hashingWriterAt) verify(r io.ReaderAt, size int64) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if !hw.inOrder || hw.next != size {
+		hw.digest = newDigest(hw.expected)
+		if _, err := io.Copy(hw.digest, io.NewSectionReader(r, 0, size)); err != nil {
+			return fmt.Errorf("read back error: %w", err)
+		}
+	}
+	return hw.digest.check(hw.expected)
+}
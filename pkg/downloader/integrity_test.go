@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"s3-crawler/pkg/files"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func multipartETag(content []byte, partSize int) string {
+	var sums []byte
+	parts := 0
+	for start := 0; start < len(content); start += partSize {
+		end := start + partSize
+		if end > len(content) {
+			end = len(content)
+		}
+		sum := md5.Sum(content[start:end])
+		sums = append(sums, sum[:]...)
+		parts++
+	}
+	sum := md5.Sum(sums)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(parts)
+}
+
+func TestNewIntegrity(t *testing.T) {
+	file := &files.File{ETag: "0123456789abcdef0123456789abcdef-3"}
+	expected := newIntegrity(file, &s3.HeadObjectOutput{ContentLength: 8, ChecksumSHA256: aws.String("abc-3")})
+	if expected.etag != file.ETag || expected.partSize != 8 || len(expected.checksums) != 0 {
+		t.Errorf("multipart integrity = %+v", expected)
+	}
+
+	file.ETag = "0123456789abcdef0123456789abcdef"
+	expected = newIntegrity(file, &s3.HeadObjectOutput{ServerSideEncryption: types.ServerSideEncryptionAwsKms, ChecksumCRC32: aws.String("AAAAAA==")})
+	if expected.etag != "" || expected.checksums[types.ChecksumAlgorithmCrc32] != "AAAAAA==" {
+		t.Errorf("encrypted integrity = %+v", expected)
+	}
+}
+
+func TestHashingWriterAtInOrder(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 25)
+	sha := sha256.Sum256(content)
+	expected := &integrity{
+		etag:      multipartETag(content, 100),
+		partSize:  100,
+		checksums: map[types.ChecksumAlgorithm]string{types.ChecksumAlgorithmSha256: base64.StdEncoding.EncodeToString(sha[:])},
+	}
+
+	buffer := files.NewBuffer()
+	hw := newHashingWriterAt(buffer, expected)
+	for start := 0; start < len(content); start += 64 {
+		end := start + 64
+		if end > len(content) {
+			end = len(content)
+		}
+		if _, err := hw.WriteAt(content[start:end], int64(start)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hw.verify(nil, int64(len(content))); err != nil {
+		t.Errorf("verify in order error: %v", err)
+	}
+}
+
+func TestHashingWriterAtOutOfOrder(t *testing.T) {
+	content := bytes.Repeat([]byte("abcdefghij"), 30)
+	sum := md5.Sum(content)
+	expected := &integrity{etag: hex.EncodeToString(sum[:])}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	hw := newHashingWriterAt(file, expected)
+	hw.WriteAt(content[150:], 150)
+	hw.WriteAt(content[:150], 0)
+	if err = hw.verify(file, int64(len(content))); err != nil {
+		t.Errorf("verify out of order error: %v", err)
+	}
+
+	file.WriteAt([]byte("X"), 10)
+	hw = newHashingWriterAt(file, expected)
+	hw.WriteAt(content[150:], 150)
+	if err = hw.verify(file, int64(len(content))); !errors.Is(err, errIntegrity) {
+		t.Errorf("verify corrupted data error = %v, want %v", err, errIntegrity)
+	}
+}
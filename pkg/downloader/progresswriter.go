@@ -1,17 +1,22 @@
 package downloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
+
+	"s3-crawler/pkg/ratelimit"
 )
 
 type progressWriterAt struct {
-	writer   io.WriterAt
-	callback func(bytes int64)
-	total    int64
-	written  int64
+	writer      io.WriterAt
+	callback    func(bytes int64)
+	total       int64
+	written     atomic.Int64 // written is updated by the concurrent parts.
+	keepPartial bool         // keepPartial keeps an incomplete file on disk so the download can be resumed.
 }
 
 func NewProgressWriterAt(writer io.WriterAt, total int64, progressCallback func(int64)) io.WriterAt {
@@ -27,29 +32,72 @@ func (pw *progressWriterAt) WriteAt(p []byte, off int64) (int, error) {
 	n, err := pw.writer.WriteAt(p, off)
 	if err == nil || errors.Is(err, io.EOF) {
 		bytes := int64(n)
-		pw.written += bytes
+		pw.written.Add(bytes)
 		pw.callback(bytes)
 	}
 	return n, err
 }
 
+// resume accounts bytes written by a previous run as already downloaded.
+func (pw *progressWriterAt) resume(bytes int64) {
+	pw.written.Add(bytes)
+	pw.callback(bytes)
+}
+
 func (pw *progressWriterAt) Close() error {
-	if pw.written != pw.total {
-		if closer, ok := pw.writer.(io.Closer); ok {
-			return closer.Close()
-		}
-		if err := os.Remove(pw.writer.(interface{ Name() string }).Name()); err != nil {
-			return err
+	var err error
+	if closer, ok := pw.writer.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if pw.written.Load() != pw.total {
+		if named, ok := pw.writer.(interface{ Name() string }); ok && !pw.keepPartial {
+			if err = os.Remove(named.Name()); err != nil {
+				return err
+			}
 		}
 		return fmt.Errorf("written bytes not equal file size")
 	}
-	if closer, ok := pw.writer.(io.Closer); ok {
-		return closer.Close()
-	}
 	pw.writer = nil
-	return nil
+	return err
 }
 
 func (pw *progressWriterAt) BytesWritten() int {
-	return int(pw.written)
+	return int(pw.written.Load())
+}
+
+// limitedWriterAt waits for the bandwidth limiter before each write, so the body of the response is read
+// no faster than the limit allows.
+type limitedWriterAt struct {
+	ctx     context.Context
+	writer  io.WriterAt
+	limiter *ratelimit.Limiter
+}
+
+func (lw *limitedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := lw.limiter.WaitN(lw.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return lw.writer.WriteAt(p, off)
+}
+
+// progressReader reports the bytes read from the stream and waits for the bandwidth limiter after each read,
+// so the stream is read no faster than the limit allows. The limiter may be nil.
+type progressReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiter  *ratelimit.Limiter
+	callback func(bytes int64)
+	read     int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	if n > 0 {
+		pr.read += int64(n)
+		pr.callback(int64(n))
+		if waitErr := pr.limiter.WaitN(pr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
 }
@@ -0,0 +1,33 @@
+package downloader
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func TestProgressWriterAtConcurrent(t *testing.T) {
+	const parts, partSize = 16, 1024
+	buffer := manager.NewWriteAtBuffer(make([]byte, parts*partSize))
+	var reported atomic.Int64
+	pw := NewProgressWriterAt(buffer, parts*partSize, func(n int64) { reported.Add(n) }).(*progressWriterAt)
+
+	var wg sync.WaitGroup
+	for part := 0; part < parts; part++ {
+		wg.Add(1)
+		go func(part int) {
+			defer wg.Done()
+			pw.WriteAt(make([]byte, partSize), int64(part*partSize))
+		}(part)
+	}
+	wg.Wait()
+
+	if pw.BytesWritten() != parts*partSize || reported.Load() != parts*partSize {
+		t.Errorf("written %d byte(s), reported %d, want %d", pw.BytesWritten(), reported.Load(), parts*partSize)
+	}
+	if err := pw.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
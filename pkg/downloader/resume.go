@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"s3-crawler/pkg/files"
+
+	"github.com/aws/smithy-go"
+)
+
+// partsState is a sidecar record of the parts of a large file that are already written to disk.
+// It is keyed by the object key and ETag, so the parts of a changed object are never reused.
+type partsState struct {
+	Key       string `json:"key"`       // Key is the key of the object.
+	ETag      string `json:"etag"`      // ETag is the ETag of the object the parts belong to.
+	Size      int64  `json:"size"`      // Size is the size of the object in bytes.
+	PartSize  int64  `json:"partSize"`  // PartSize is the size of each part in bytes.
+	Completed []bool `json:"completed"` // Completed marks the parts which are fully written.
+	path      string
+	file      *os.File // file is the temporary file the parts are written to, it is synced before a part is recorded.
+	mu        sync.Mutex
+}
+
+// loadPartsState reads the sidecar of the file at filePath. If the sidecar is missing or describes
+// another object version, a fresh state is returned and no previously written data is reused.
+func loadPartsState(filePath string, fileData *files.File, partSize int64, parts int) *partsState {
+	state := &partsState{
+		Key:       fileData.Key,
+		ETag:      fileData.ETag,
+		Size:      fileData.Size,
+		PartSize:  partSize,
+		Completed: make([]bool, parts),
+		path:      filePath + files.PartsSuffix,
+	}
+
+	content, err := os.ReadFile(state.path)
+	if err != nil {
+		return state
+	}
+	var saved partsState
+	if err = json.Unmarshal(content, &saved); err != nil {
+		return state
+	}
+	if saved.Key != state.Key || saved.ETag != state.ETag || saved.Size != state.Size ||
+		saved.PartSize != state.PartSize || len(saved.Completed) != parts {
+		return state
+	}
+	state.Completed = saved.Completed
+	return state
+}
+
+// reset marks all parts as missing.
+func (state *partsState) reset() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Completed = make([]bool, len(state.Completed))
+}
+
+// missingParts returns the indexes of the parts which are not written yet.
+func (state *partsState) missingParts() []int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	missing := make([]int, 0, len(state.Completed))
+	for i, done := range state.Completed {
+		if !done {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// completedBytes returns the number of bytes which are already written to disk.
+func (state *partsState) completedBytes() int64 {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	var total int64
+	for i, done := range state.Completed {
+		if done {
+			start, end := state.partRange(i)
+			total += end - start + 1
+		}
+	}
+	return total
+}
+
+// partRange returns the first and the last byte offsets of the part.
+func (state *partsState) partRange(part int) (start, end int64) {
+	start = int64(part) * state.PartSize
+	end = start + state.PartSize - 1
+	if end >= state.Size {
+		end = state.Size - 1
+	}
+	return start, end
+}
+
+// complete marks the part as written and persists the sidecar. The file is synced first, so after a crash
+// the sidecar never claims a part whose data didn't reach the disk.
+func (state *partsState) complete(part int) error {
+	if state.file != nil {
+		if err := state.file.Sync(); err != nil {
+			return fmt.Errorf("sync file %s error: %w", state.file.Name(), err)
+		}
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Completed[part] = true
+	return state.save()
+}
+
+// save atomically writes the sidecar next to the data file.
+func (state *partsState) save() error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmpPath := state.path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("write parts state %s error: %w", state.path, err)
+	}
+	return os.Rename(tmpPath, state.path)
+}
+
+// remove deletes the sidecar once the file is complete or its data can't be reused.
+func (state *partsState) remove() {
+	if err := os.Remove(state.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Remove parts state %s error: %v\n", state.path, err)
+	}
+}
+
+// isObjectChanged reports whether the request failed because the object ETag no longer matches.
+func isObjectChanged(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed"
+}
@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"s3-crawler/pkg/files"
+)
+
+func TestPartsStateResume(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "TestPartsStateResume")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filePath := filepath.Join(tempDir, "large.bin")
+	fileData := &files.File{Key: "dir/large.bin", ETag: "etag", Size: 25}
+
+	state := loadPartsState(filePath, fileData, 10, 3)
+	if missing := state.missingParts(); len(missing) != 3 {
+		t.Fatalf("Expected 3 missing parts, got %d", len(missing))
+	}
+	if err = state.complete(2); err != nil {
+		t.Fatalf("Error saving parts state: %v", err)
+	}
+
+	resumed := loadPartsState(filePath, fileData, 10, 3)
+	if missing := resumed.missingParts(); len(missing) != 2 || missing[0] != 0 || missing[1] != 1 {
+		t.Errorf("Expected parts [0 1] to be missing, got %v", missing)
+	}
+	if bytes := resumed.completedBytes(); bytes != 5 {
+		t.Errorf("Expected 5 completed bytes, got %d", bytes)
+	}
+
+	fileData.ETag = "changed"
+	if missing := loadPartsState(filePath, fileData, 10, 3).missingParts(); len(missing) != 3 {
+		t.Errorf("Expected parts of a changed object to be discarded, got %d missing", len(missing))
+	}
+}
+
+func TestPartsStateSyncFailure(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "large.bin")
+	file, err := os.Create(filePath + files.TempSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	state := loadPartsState(filePath, &files.File{Key: "dir/large.bin", ETag: "etag", Size: 25}, 10, 3)
+	state.file = file
+	if err = state.complete(0); err == nil {
+		t.Fatalf("Expected the part not to be recorded when the file can't be synced")
+	}
+	if missing := state.missingParts(); len(missing) != 3 {
+		t.Errorf("Expected 3 missing parts, got %v", missing)
+	}
+	if _, err = os.Stat(filePath + files.PartsSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no sidecar, stat error: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"s3-crawler/pkg/archives"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/retry"
+	"s3-crawler/pkg/s3client"
+	"s3-crawler/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// isStreamed reports whether the archive is larger than the stream threshold, so it is decompressed on the fly.
+func (downloader *Downloader) isStreamed(fileData *files.File) bool {
+	threshold := downloader.cfg.Archives.GetStreamThreshold()
+	return threshold > 0 && fileData.Size > threshold && downloader.isDecompressed(fileData)
+}
+
+// downloadStream decompresses the archive on the fly from the sequential reads of the object straight to disk,
+// so neither the archive nor the decompressed data is held in memory. The extracted files are written to their
+// temporary paths and renamed and committed with the archive record only once the whole object is read and
+// verified. A failed attempt removes them and extracts the archive again.
+func (downloader *Downloader) downloadStream(ctx context.Context, fileData *files.File, data *files.FileCollection, expected *integrity) (err error) {
+	reader := &progressReader{
+		ctx: ctx,
+		reader: &streamReader{
+			ctx:        ctx,
+			downloader: downloader,
+			file:       fileData,
+			partSize:   downloader.cfg.GetChunkSize(),
+		},
+		limiter: downloader.limiter,
+		callback: func(n int64) {
+			data.UpdateProgress(n)
+		},
+	}
+	stage := archives.NewStage(fileData, downloader.cfg.IsFsync)
+	defer func() {
+		// The file is downloaded again by a retry, so its progress is rolled back.
+		if err != nil {
+			stage.Rollback()
+			data.UpdateProgress(-reader.read)
+		}
+	}()
+	var r io.Reader = reader
+	var d *digest
+	if expected != nil {
+		d = newDigest(expected)
+		r = io.TeeReader(reader, d)
+	}
+
+	if _, err = downloader.extractor.Stream(fileData, r, stage.Save); err != nil {
+		return fmt.Errorf("decompress file %s error: %w", fileData.Name, err)
+	}
+	// The data after the end of the archive, like the padding of tar, is read to check the size and the hashes.
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("download file %s error: %w", fileData.Name, err)
+	}
+	if reader.read != fileData.Size {
+		return fmt.Errorf("written bytes not equal file size")
+	}
+	if d != nil {
+		if err = d.check(expected); err != nil {
+			return fmt.Errorf("file %s: %w", fileData.Name, err)
+		}
+	}
+
+	entries := stage.Len()
+	if err = stage.Commit(downloader.cache.Commit); err != nil {
+		return fmt.Errorf("save file %s error: %w", fileData.Name, err)
+	}
+	if fileData.IsMultiEntry() {
+		downloader.cache.CommitArchive(fileData, entries)
+	}
+	data.MarkAsDownloaded(fileData)
+	return nil
+}
+
+// streamReader reads the object sequentially by ranged requests of the part size, so a single part is in flight
+// and the memory stays bounded regardless of the object size. Each request is conditional on the ETag of the
+// object. A body broken by a temporary error is requested again from the current offset.
+type streamReader struct {
+	ctx        context.Context
+	downloader *Downloader
+	file       *files.File
+	partSize   int64
+	offset     int64         // offset is the offset of the next byte to read.
+	end        int64         // end is the offset after the range of the current body.
+	body       io.ReadCloser // body is the body of the current range, nil if the next range isn't requested yet.
+	retries    int           // retries is the number of broken bodies of the current part.
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for r.offset < r.file.Size {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+		if remaining := r.end - r.offset; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		switch {
+		case r.offset == r.end:
+			r.close()
+			r.retries = 0
+		case err != nil:
+			r.close()
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			if r.retries >= maxPartBodyRetries || !retry.IsRetryable(err) || r.ctx.Err() != nil {
+				return n, fmt.Errorf("read object %s error: %w", r.file.Key, err)
+			}
+			r.retries++
+			log.Printf("Read object %s error: %v. Continue from %s.\n", r.file.Key, err, utils.FormatBytes(r.offset))
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, io.EOF
+}
+
+// open requests the rest of the current part from the offset. Failed requests are retried by the policy.
+func (r *streamReader) open() error {
+	r.end = (r.offset/r.partSize + 1) * r.partSize
+	if r.end > r.file.Size {
+		r.end = r.file.Size
+	}
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(r.downloader.cfg.BucketName),
+		Key:     aws.String(r.file.Key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", r.offset, r.end-1)),
+		IfMatch: aws.String("\"" + r.file.ETag + "\""),
+	}
+	if r.file.VersionID != "" {
+		input.VersionId = aws.String(r.file.VersionID)
+	}
+	// The body is read after the request returns, so the attempts have no timeout unlike Policy.Do.
+	policy := r.downloader.retry
+	for attempt := 1; ; attempt++ {
+		output, err := r.downloader.GetObject(r.ctx, input, s3client.DisableRetries)
+		if err == nil {
+			r.body = output.Body
+			return nil
+		}
+		if !policy.ShouldRetry(r.ctx, err, attempt) {
+			return fmt.Errorf("get object %s error: %w", r.file.Key, err)
+		}
+		delay := policy.Backoff(attempt)
+		log.Printf("Get object %s error: %v. Retry in %s (attempt %d of %d).\n", r.file.Key, err, delay.Truncate(time.Millisecond), attempt+1, policy.MaxAttempts)
+		if err = retry.Sleep(r.ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *streamReader) close() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
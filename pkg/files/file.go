@@ -5,7 +5,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
@@ -20,23 +22,36 @@ const (
 	KiB = 1 << 10
 	MiB = 1 << 20
 
-	decompressedDir    = "decompressed"
+	DecompressedDir    = "decompressed" // DecompressedDir is the directory decompressed files are saved to.
 	decompressedSuffix = ""
 	delimiter          = '_'
+
+	// PartsSuffix is the suffix of the sidecar file which stores the downloaded parts of a large file.
+	PartsSuffix = ".parts.json"
+	// TempSuffix is the suffix of the temporary file which is renamed to the file name once it is complete.
+	// It is specific to the crawler, so the stale temporary files are never confused with the files of the user.
+	TempSuffix = ".s3-crawler.part"
+)
+
+const (
+	ReasonNew     = "new"     // ReasonNew is the reason to download an object without a local file.
+	ReasonChanged = "changed" // ReasonChanged is the reason to download an object whose local file differs.
 )
 
-// archives is a map of known archive extensions.
-var archives map[string]bool
-
-func init() {
-	archives = map[string]bool{
-		".zip":  false,
-		".rar":  false,
-		".tar":  false,
-		".gz":   true,
-		".gzip": true,
-		".bz2":  false,
-		".7z":   false,
+// archives are the extensions of the archive formats registered by RegisterArchive. The value reports whether
+// the archive has several entries, like zip. The entries are saved into the decompressed directory, the archive
+// name keeps the extension, so it never collides with an entry.
+var archives = make(map[string]bool)
+
+// compoundExtensions are the registered extensions which consist of two extensions, like .tar.gz.
+var compoundExtensions []string
+
+// RegisterArchive registers the extension of an archive format, so the save paths of the archives are defined
+// by the formats the archives package extracts. It is called by the package on initialization.
+func RegisterArchive(ext string, multiEntry bool) {
+	archives[ext] = multiEntry
+	if strings.Count(ext, ".") > 1 {
+		compoundExtensions = append(compoundExtensions, ext)
 	}
 }
 
@@ -47,8 +62,13 @@ type File struct {
 	Name        string // Name is the name of the file.
 	ETag        string // ETag is the ETag of the file.
 	Extension   string
-	Path        string // Path to save file
-	Size        int64  // Size is the size of the file in bytes.
+	Path        string    // Path to save file
+	Size        int64     // Size is the size of the file in bytes.
+	VersionID   string    // VersionID is the version of the object to download, empty for the current version.
+	Reason      string    // Reason is why the file is downloaded: ReasonNew or ReasonChanged.
+	ModTime     time.Time // ModTime is the modification time set to the saved file, the LastModified of the object by default.
+	Archive     string    // Archive is the local path of the archive the file is extracted from, empty for objects.
+	Link        string    // Link is the target of a symbolic link extracted from an archive, empty for regular files.
 	IsSmallFile bool
 }
 
@@ -78,6 +98,14 @@ func (d *Data) WriteAt(p []byte, off int64) (int, error) {
 	return d.Write(p)
 }
 
+// Release returns the buffer of the data to the pool, the data can't be used after it.
+func (d *Data) Release() {
+	if d != nil && d.Buffer != nil {
+		putBuffer(d.Buffer)
+		d.Buffer = nil
+	}
+}
+
 func NewBuffer() *Data {
 	return &Data{
 		Buffer: getBuffer(),
@@ -95,9 +123,10 @@ var filePool = sync.Pool{
 func NewFileFromObject(obj types.Object, localPath string, isFlattenName, isWithDirName, isDecompress bool) *File {
 	file := filePool.Get().(*File)
 	file.Key = *obj.Key
-	file.Extension = filepath.Ext(file.Key)
+	file.Extension = Ext(file.Key)
 	file.defineSavePath(localPath, isFlattenName, isWithDirName, isDecompress)
 	file.Size = obj.Size
+	file.ModTime = aws.ToTime(obj.LastModified)
 	file.ETag = (*obj.ETag)[1 : len(*obj.ETag)-1] // strings.Trim(*obj.ETag, "\"")
 	return file
 }
@@ -108,14 +137,16 @@ func (file *File) defineSavePath(localPath string, isFlattenName, isWithDirName,
 	var builder strings.Builder
 
 	if isFlattenName {
-		parts := strings.Split(path, string(filepath.Separator))
-		for i, part := range parts {
-			if i > 0 {
-				builder.WriteRune(delimiter)
+		if path != "." {
+			parts := strings.Split(filepath.ToSlash(path), "/")
+			for i, part := range parts {
+				if i > 0 {
+					builder.WriteRune(delimiter)
+				}
+				builder.WriteString(part)
 			}
-			builder.WriteString(part)
+			builder.WriteRune(delimiter)
 		}
-		builder.WriteRune(delimiter)
 		builder.WriteString(fileName)
 		fileName = builder.String()
 		builder.Reset()
@@ -124,12 +155,16 @@ func (file *File) defineSavePath(localPath string, isFlattenName, isWithDirName,
 	if file.IsArchive() && isDecompress {
 		builder.WriteString(path)
 		builder.WriteRune(filepath.Separator)
-		builder.WriteString(decompressedDir)
-		if isWithDirName {
+		builder.WriteString(DecompressedDir)
+		// The entries of multi-entry archives are extracted to the directory of the archive, so entries
+		// with the same names in different archives never collide.
+		if isWithDirName || file.IsMultiEntry() {
 			builder.WriteRune(filepath.Separator)
 			builder.WriteString(fileName)
 		}
-		fileName = strings.TrimSuffix(fileName, file.Extension) + decompressedSuffix
+		if !file.IsMultiEntry() {
+			fileName = strings.TrimSuffix(fileName, file.Extension) + decompressedSuffix
+		}
 		path = builder.String()
 		builder.Reset()
 	}
@@ -138,6 +173,24 @@ func (file *File) defineSavePath(localPath string, isFlattenName, isWithDirName,
 	file.Name = fileName
 }
 
+// SaveAsVersion changes the save path of the file to key/<versionId>, so all versions of the object
+// are saved side by side.
+func (file *File) SaveAsVersion(versionID string) {
+	file.VersionID = versionID
+	file.Path = filepath.Join(file.Path, file.Name)
+	file.Name = versionID
+}
+
+// LocalPath returns the full path the file is saved to.
+func (file *File) LocalPath() string {
+	return filepath.Join(file.Path, file.Name)
+}
+
+// TempPath returns the path of the temporary file the data is written to before it is complete.
+func (file *File) TempPath() string {
+	return file.LocalPath() + TempSuffix
+}
+
 // NewFile creates a new File objects from the pool.
 func NewFile() *File {
 	file := filePool.Get().(*File)
@@ -159,16 +212,48 @@ func (file *File) reset() {
 		file.ETag = ""
 		file.Extension = ""
 		file.Path = ""
-		if file.Data != nil && file.Data.Buffer != nil {
-			file.Data.Buffer.Reset()
-			putBuffer(file.Data.Buffer)
-		}
+		file.VersionID = ""
+		file.Reason = ""
+		file.ModTime = time.Time{}
+		file.Archive = ""
+		file.Link = ""
+		file.Data.Release()
+		file.Data = nil
 	}
 }
 
 func (file *File) IsArchive() bool {
+	_, ok := archives[file.Extension]
+	return ok
+}
+
+// IsMultiEntry reports whether the file is an archive with several entries, like zip.
+func (file *File) IsMultiEntry() bool {
 	return archives[file.Extension]
 }
+
+// SetDetectedArchive makes the file without an extension an archive of the single-stream format detected by
+// its data, so it is decompressed and saved into the decompressed directory like a file with the extension.
+func (file *File) SetDetectedArchive(ext string, isWithDirName bool) {
+	file.Extension = ext
+	if isWithDirName {
+		file.Path = filepath.Join(file.Path, DecompressedDir, file.Name)
+	} else {
+		file.Path = filepath.Join(file.Path, DecompressedDir)
+	}
+}
+
+// Ext returns the extension of the name like filepath.Ext, but the compound extensions of compressed
+// tar archives, like .tar.gz, are returned whole.
+func Ext(name string) string {
+	for _, ext := range compoundExtensions {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return filepath.Ext(name)
+}
+
 func (file *File) isEmpty() bool {
 	return file.Key == "" &&
 		file.Name == "" &&
@@ -176,6 +261,5 @@ func (file *File) isEmpty() bool {
 		file.Extension == "" &&
 		file.Size == 0 &&
 		file.Path == "" &&
-		file.Data == nil &&
-		(file.Data.Buffer == nil || file.Data.Len() == 0)
+		file.Data == nil
 }
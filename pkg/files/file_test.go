@@ -0,0 +1,77 @@
+package files
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// The archives package registers its formats, it can't be imported here.
+func init() {
+	RegisterArchive(".gz", false)
+	RegisterArchive(".zst", false)
+	RegisterArchive(".zip", true)
+	RegisterArchive(".tar.gz", true)
+	RegisterArchive(".tar.zst", true)
+}
+
+func TestDefineSavePath(t *testing.T) {
+	tests := []struct {
+		key                                        string
+		isFlattenName, isWithDirName, isDecompress bool
+		want                                       string
+	}{
+		{key: "a/report.csv", want: "a/report.csv"},
+		{key: "b/report.csv", want: "b/report.csv"},
+		{key: "report.csv", isFlattenName: true, want: "report.csv"},
+		{key: "a/b/report.csv", isFlattenName: true, want: "a_b_report.csv"},
+		{key: "a/report.csv.gz", want: "a/report.csv.gz"},
+		{key: "a/report.csv.gz", isDecompress: true, want: "a/decompressed/report.csv"},
+		{key: "a/report.csv.gz", isDecompress: true, isWithDirName: true, want: "a/decompressed/report.csv.gz/report.csv"},
+		{key: "a/b/report.csv.gz", isFlattenName: true, isDecompress: true, want: "decompressed/a_b_report.csv"},
+		{key: "a/drop.zip", isDecompress: true, want: "a/decompressed/drop.zip/drop.zip"},
+		{key: "a/drop.zip", isDecompress: true, isWithDirName: true, want: "a/decompressed/drop.zip/drop.zip"},
+		{key: "a/logs.tar.gz", isDecompress: true, want: "a/decompressed/logs.tar.gz/logs.tar.gz"},
+		{key: "a/logs.tar.gz", want: "a/logs.tar.gz"},
+	}
+
+	for _, test := range tests {
+		file := &File{Key: test.key, Extension: Ext(test.key)}
+		file.defineSavePath("/data", test.isFlattenName, test.isWithDirName, test.isDecompress)
+
+		if got := filepath.ToSlash(file.LocalPath()); got != "/data/"+test.want {
+			t.Errorf("Wrong save path for key %s. \nWant: %s\nGot:  %s", test.key, "/data/"+test.want, got)
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	for name, want := range map[string]string{
+		"a/report.csv":    ".csv",
+		"a/report.csv.gz": ".gz",
+		"a/logs.tar.gz":   ".tar.gz",
+		"a/logs.tar.zst":  ".tar.zst",
+		"a/logs.tgz":      ".tgz",
+		"a/tar.gz/file":   "",
+		"a/README":        "",
+	} {
+		if got := Ext(name); got != want {
+			t.Errorf("Ext(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSetDetectedArchive(t *testing.T) {
+	for _, isWithDirName := range []bool{false, true} {
+		file := &File{Key: "a/blob", Extension: Ext("a/blob")}
+		file.defineSavePath("/data", false, isWithDirName, true)
+		file.SetDetectedArchive(".gz", isWithDirName)
+
+		want := "/data/a/decompressed/blob"
+		if isWithDirName {
+			want = "/data/a/decompressed/blob/blob"
+		}
+		if got := filepath.ToSlash(file.LocalPath()); got != want || !file.IsArchive() {
+			t.Errorf("Wrong save path of the detected archive. \nWant: %s\nGot:  %s", want, got)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,6 +10,7 @@ import (
 const growChanCoefficient = 10
 
 // FileCollection represents a collection of File objects.
+// Files are sent to the DownloadChan as soon as they are listed, so the totals grow while the listing is in progress.
 type FileCollection struct {
 	DownloadChan    chan *File // DownloadChan is a channel of File objects.
 	ArchivesChan    chan *File
@@ -16,9 +18,12 @@ type FileCollection struct {
 	totalBytes      int64  // totalBytes is the total number of bytes in the DownloadChan collection.
 	count           uint32 // count is the current count of objects in the DownloadChan collection.
 	archivesCount   int
-	progress        atomic.Int64 // progress is the current sum of a bytes downloaded from bucket
-	progressMap     map[*File]int64
-	DownloadedFiles map[*File]struct{}
+	progress        atomic.Int64        // progress is the current sum of a bytes downloaded from bucket
+	downloadedCount atomic.Uint32       // downloadedCount is the number of processed files.
+	failures        map[string]*Failure // failures are the failed files by the local path.
+	pending         []Pending           // pending are the files skipped after the collection is stopped.
+	violations      []Violation         // violations are the archives rejected by the safety limits.
+	stopped         atomic.Bool
 	mu              sync.RWMutex
 	wg              sync.WaitGroup
 }
@@ -26,29 +31,26 @@ type FileCollection struct {
 // NewFileCollection returns a new instance of the FileCollection structure with the specified capacity.
 func NewFileCollection(capacity int) *FileCollection {
 	return &FileCollection{
-		DownloadChan:    make(chan *File, capacity*growChanCoefficient),
-		progressMap:     make(map[*File]int64),
-		DownloadedFiles: make(map[*File]struct{}),
-		mu:              sync.RWMutex{},
-		wg:              sync.WaitGroup{},
+		DownloadChan: make(chan *File, capacity*growChanCoefficient),
+		ArchivesChan: make(chan *File, capacity),
+		DataChan:     make(chan *File, capacity*growChanCoefficient),
+		failures:     make(map[string]*Failure),
+		mu:           sync.RWMutex{},
+		wg:           sync.WaitGroup{},
 	}
 }
 
-func (fc *FileCollection) CreateChannels() {
-	fc.DataChan = make(chan *File, fc.Count())
-	fc.ArchivesChan = make(chan *File, fc.ArchivesCount())
-}
-
-func (fc *FileCollection) GetDataToDownload() {
-	for file := range fc.progressMap {
-		fc.DownloadChan <- file
-	}
+// AddToDownload adds the file to the totals and sends it to the DownloadChan.
+// It blocks while the channel is full, so the listing doesn't outrun the downloaders.
+func (fc *FileCollection) AddToDownload(file *File) {
+	fc.AddToProgress(file)
+	fc.DownloadChan <- file
 }
 
+// AddToProgress adds the file to the totals of the collection.
 func (fc *FileCollection) AddToProgress(file *File) {
 	fc.mu.Lock()
 	defer fc.mu.Unlock()
-	fc.progressMap[file] = 0
 	fc.totalBytes += file.Size
 	fc.count++
 	if file.IsArchive() {
@@ -61,7 +63,7 @@ func (fc *FileCollection) GetStatistics(duration time.Duration) (count, download
 	fc.mu.Lock()
 	defer fc.mu.Unlock()
 	count = fc.count
-	downloadedCount = uint32(len(fc.DownloadedFiles))
+	downloadedCount = fc.downloadedCount.Load()
 	remainingCount = count - downloadedCount
 	totalBytes = fc.totalBytes
 	progressBytes = fc.progress.Load()
@@ -75,10 +77,151 @@ func (fc *FileCollection) UpdateProgress(writtenBytes int64) {
 	fc.progress.Add(writtenBytes)
 }
 
+// Failure is a file which failed to download, decompress or save.
+type Failure struct {
+	Key      string `json:"key"`      // Key is the key of the object.
+	Path     string `json:"path"`     // Path is the local path of the file.
+	Error    string `json:"error"`    // Error is the last error of the file.
+	Attempts int    `json:"attempts"` // Attempts is the number of failed attempts.
+	file     *File  // file is set while the download can be retried.
+}
+
+// MarkAsDownloaded counts the file as downloaded and removes it from the failures of the previous attempts.
+// It must be called before the file is passed to another goroutine.
 func (fc *FileCollection) MarkAsDownloaded(file *File) {
+	fc.downloadedCount.Add(1)
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.failures, file.LocalPath())
+}
+
+// MarkAsFailed records the error of the file. A retryable file is kept for TakeRetryable, otherwise only
+// the key and the path are recorded and the caller may return the file to the pool.
+func (fc *FileCollection) MarkAsFailed(file *File, err error, retryable bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	path := file.LocalPath()
+	failure, ok := fc.failures[path]
+	if !ok {
+		failure = &Failure{Key: file.Key, Path: path}
+		fc.failures[path] = failure
+	}
+	failure.Error = err.Error()
+	failure.Attempts++
+	failure.file = nil
+	if retryable {
+		failure.file = file
+	}
+}
+
+// MarkAsNotSaved records the error of the file downloaded in memory, which failed to be decompressed or saved
+// by the writers. The file was counted as downloaded before it was passed to them, so it is uncounted.
+func (fc *FileCollection) MarkAsNotSaved(file *File, err error) {
+	fc.downloadedCount.Add(^uint32(0))
+	fc.MarkAsFailed(file, err, false)
+}
+
+// TakeRetryable returns the failed files which can be downloaded again. The failures stay recorded
+// until the files are marked as downloaded.
+func (fc *FileCollection) TakeRetryable() []*File {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	var retry []*File
+	for _, failure := range fc.failures {
+		if failure.file != nil {
+			retry = append(retry, failure.file)
+			failure.file = nil
+		}
+	}
+	return retry
+}
+
+// Failures returns the failed files sorted by the key.
+func (fc *FileCollection) Failures() []Failure {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	failures := make([]Failure, 0, len(fc.failures))
+	for _, failure := range fc.failures {
+		failures = append(failures, *failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Key != failures[j].Key {
+			return failures[i].Key < failures[j].Key
+		}
+		return failures[i].Path < failures[j].Path
+	})
+	return failures
+}
+
+// Violation is an archive which is not extracted because it is unsafe: it has an entry outside of the output
+// directory or exceeds the safety limits.
+type Violation struct {
+	Key    string `json:"key"`    // Key is the key of the object.
+	Path   string `json:"path"`   // Path is the local path of the archive.
+	Reason string `json:"reason"` // Reason is the violated limit.
+}
+
+// AddViolation records the unsafe archive and removes it from the failures of the previous attempts.
+// It isn't downloaded again, so the caller may return the file to the pool. If downloaded is set, the archive
+// was counted as downloaded before it was rejected, so it is uncounted.
+func (fc *FileCollection) AddViolation(file *File, err error, downloaded bool) {
+	if downloaded {
+		fc.downloadedCount.Add(^uint32(0))
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.failures, file.LocalPath())
+	fc.violations = append(fc.violations, Violation{Key: file.Key, Path: file.LocalPath(), Reason: err.Error()})
+}
+
+// Violations returns the unsafe archives sorted by the key.
+func (fc *FileCollection) Violations() []Violation {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	violations := append([]Violation(nil), fc.violations...)
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Key < violations[j].Key
+	})
+	return violations
+}
+
+// Pending is a listed file which wasn't downloaded because the run was stopped.
+type Pending struct {
+	Key  string `json:"key"`  // Key is the key of the object.
+	Path string `json:"path"` // Path is the local path of the file.
+	Size int64  `json:"size"` // Size is the size of the object in bytes.
+}
+
+// Stop stops the processing of new files. The files received from the DownloadChan after it should be
+// recorded by AddPending instead of being downloaded.
+func (fc *FileCollection) Stop() {
+	fc.stopped.Store(true)
+}
+
+// IsStopped reports whether the collection is stopped.
+func (fc *FileCollection) IsStopped() bool {
+	return fc.stopped.Load()
+}
+
+// AddPending records the file which is not downloaded because the collection is stopped.
+func (fc *FileCollection) AddPending(file *File) {
 	fc.mu.Lock()
 	defer fc.mu.Unlock()
-	fc.DownloadedFiles[file] = struct{}{}
+	fc.pending = append(fc.pending, Pending{Key: file.Key, Path: file.LocalPath(), Size: file.Size})
+}
+
+// Pending returns the pending files sorted by the key.
+func (fc *FileCollection) Pending() []Pending {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	pending := append([]Pending(nil), fc.pending...)
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Key != pending[j].Key {
+			return pending[i].Key < pending[j].Key
+		}
+		return pending[i].Path < pending[j].Path
+	})
+	return pending
 }
 
 func (fc *FileCollection) ArchivesCount() int {
@@ -93,10 +236,3 @@ func (fc *FileCollection) Count() uint32 {
 	defer fc.mu.RUnlock()
 	return fc.count
 }
-
-func (fc *FileCollection) IsDownloaded(file *File) bool {
-	fc.mu.RLock()
-	defer fc.mu.RUnlock()
-	_, ok := fc.DownloadedFiles[file]
-	return ok
-}
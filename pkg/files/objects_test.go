@@ -0,0 +1,76 @@
+package files
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileCollectionFailures(t *testing.T) {
+	data := NewFileCollection(1)
+	first := &File{Key: "b/first.txt", Path: "/data/b", Name: "first.txt"}
+	second := &File{Key: "a/second.txt", Path: "/data/a", Name: "second.txt"}
+
+	data.MarkAsFailed(first, errors.New("timeout"), true)
+	data.MarkAsFailed(second, errors.New("no space left"), false)
+
+	retry := data.TakeRetryable()
+	if len(retry) != 1 || retry[0] != first {
+		t.Fatalf("TakeRetryable = %v, want the first file", retry)
+	}
+	if retry = data.TakeRetryable(); len(retry) != 0 {
+		t.Errorf("TakeRetryable must return the file once, got %v", retry)
+	}
+
+	data.MarkAsFailed(first, errors.New("reset by peer"), true)
+	failures := data.Failures()
+	if len(failures) != 2 || failures[0].Key != second.Key || failures[1].Attempts != 2 || failures[1].Error != "reset by peer" {
+		t.Errorf("Failures = %+v", failures)
+	}
+
+	data.TakeRetryable()
+	data.MarkAsDownloaded(first)
+	if failures = data.Failures(); len(failures) != 1 || failures[0].Key != second.Key {
+		t.Errorf("Failures after the retry = %+v", failures)
+	}
+}
+
+func TestFileCollectionNotSaved(t *testing.T) {
+	data := NewFileCollection(1)
+	file := &File{Key: "a/report.csv", Path: "/data/a", Name: "report.csv", Size: 10}
+	data.AddToProgress(file)
+	// A file downloaded in memory is counted before the writer fails to save it.
+	data.MarkAsDownloaded(file)
+	data.MarkAsNotSaved(file, errors.New("no space left"))
+
+	if _, downloaded, remaining, _, _, _, _ := data.GetStatistics(time.Second); downloaded != 0 || remaining != 1 {
+		t.Errorf("the file which failed to be saved must not be counted as downloaded, got %d downloaded, %d remaining", downloaded, remaining)
+	}
+	if failures := data.Failures(); len(failures) != 1 || failures[0].Error != "no space left" {
+		t.Errorf("Failures = %+v", failures)
+	}
+	if retry := data.TakeRetryable(); len(retry) != 0 {
+		t.Errorf("the file which failed to be saved must not be retried, got %v", retry)
+	}
+}
+
+func TestFileCollectionViolations(t *testing.T) {
+	data := NewFileCollection(1)
+	archive := &File{Key: "a/bomb.gz", Path: "/data/a", Name: "bomb"}
+	data.MarkAsFailed(archive, errors.New("timeout"), true)
+	data.AddViolation(archive, errors.New("unsafe archive"), false)
+	// An archive decompressed in memory is counted as downloaded before it is rejected.
+	inMemory := &File{Key: "a/slip.zip", Path: "/data/a/decompressed", Name: "slip.zip"}
+	data.MarkAsDownloaded(inMemory)
+	data.AddViolation(inMemory, errors.New("unsafe archive"), true)
+
+	if violations := data.Violations(); len(violations) != 2 || violations[0].Key != archive.Key {
+		t.Errorf("Violations = %+v", violations)
+	}
+	if failures := data.Failures(); len(failures) != 0 {
+		t.Errorf("the unsafe archive must be removed from the failures, got %+v", failures)
+	}
+	if _, downloaded, _, _, _, _, _ := data.GetStatistics(time.Second); downloaded != 0 {
+		t.Errorf("rejected archives must not be counted as downloaded, got %d", downloaded)
+	}
+}
@@ -0,0 +1,166 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	includePrefix = "+ "
+	excludePrefix = "- "
+	regexPrefix   = "re:"
+	commentPrefix = "#"
+)
+
+// Filter is an ordered list of include and exclude rules. The first rule matching the key decides
+// whether the key is included, keys matching no rule are included. A nil Filter includes every key.
+//
+// A rule is "+ pattern" to include or "- pattern" to exclude. The pattern is a regular expression
+// if it starts with "re:", otherwise it is a glob:
+//   - "*" matches any characters except "/", "**" matches any characters including "/",
+//     "?" matches a single character except "/" and "[...]" matches a character class;
+//   - a glob without "/" matches the last segment of the key at any level, like "*.tmp";
+//   - a glob with "/" matches the whole key, a leading "/" is ignored;
+//   - a glob ending with "/" matches every key under the directory, like "logs/".
+//
+// A regular expression is matched against the whole key and is not anchored.
+type Filter struct {
+	rules []rule
+}
+
+type rule struct {
+	include  bool
+	baseName bool // baseName specifies whether the pattern matches the last segment of the key.
+	pattern  *regexp.Regexp
+}
+
+// New compiles the rules in the order they are given. Empty lines and lines starting with "#" are skipped.
+// It returns nil if there are no rules.
+func New(lines []string) (*Filter, error) {
+	filter := &Filter{}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d %q: %w", i+1, line, err)
+		}
+		filter.rules = append(filter.rules, r)
+	}
+	if len(filter.rules) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// ReadFile reads the rules from the file, one rule per line.
+func ReadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read rules file %s error: %w", path, err)
+	}
+	return lines, nil
+}
+
+// Match reports whether the slash-separated key is included by the rules.
+func (filter *Filter) Match(key string) bool {
+	if filter == nil {
+		return true
+	}
+	base := key[strings.LastIndex(key, "/")+1:]
+	for _, r := range filter.rules {
+		value := key
+		if r.baseName {
+			value = base
+		}
+		if r.pattern.MatchString(value) {
+			return r.include
+		}
+	}
+	return true
+}
+
+func parseRule(line string) (rule, error) {
+	var r rule
+	switch {
+	case strings.HasPrefix(line, includePrefix):
+		r.include = true
+	case strings.HasPrefix(line, excludePrefix):
+	default:
+		return r, fmt.Errorf("rule must start with %q or %q", includePrefix, excludePrefix)
+	}
+	pattern := strings.TrimSpace(line[len(includePrefix):])
+	if pattern == "" {
+		return r, fmt.Errorf("empty pattern")
+	}
+
+	var err error
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		r.pattern, err = regexp.Compile(expr)
+		return r, err
+	}
+	r.baseName = !strings.Contains(pattern, "/")
+	r.pattern, err = regexp.Compile(globToRegexp(pattern))
+	return r, err
+}
+
+// globToRegexp converts the glob to an anchored regular expression.
+func globToRegexp(glob string) string {
+	glob = strings.TrimPrefix(glob, "/")
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// "**/" also matches no directories, so "a/**/b" matches "a/b".
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					builder.WriteString("(?:.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	builder.WriteString("$")
+	return builder.String()
+}
@@ -0,0 +1,71 @@
+package filter
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	filter, err := New([]string{
+		"# logs are never needed",
+		"- logs/",
+		"+ data/**/keep/*.csv",
+		"- data/**",
+		"- *.tmp",
+		"- re:\\.bak[0-9]+$",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "logs/2023/app.log", want: false},
+		{key: "a/logs/app.log", want: true},
+		{key: "data/keep/file.csv", want: true},
+		{key: "data/2023/08/keep/file.csv", want: true},
+		{key: "data/2023/08/keep/file.txt", want: false},
+		{key: "data/file.csv", want: false},
+		{key: "other/file.tmp", want: false},
+		{key: "file.tmp", want: false},
+		{key: "file.tmp.gz", want: true},
+		{key: "other/file.bak12", want: false},
+		{key: "other/file.csv", want: true},
+	}
+	for _, test := range tests {
+		if got := filter.Match(test.key); got != test.want {
+			t.Errorf("Match(%q) = %t, want %t", test.key, got, test.want)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{glob: "*.gz", want: `^[^/]*\.gz$`},
+		{glob: "/a/**/b?", want: `^a/(?:.*/)?b[^/]$`},
+		{glob: "a/[!0-9]*", want: `^a/[^0-9][^/]*$`},
+		{glob: "dir/", want: `^dir/.*$`},
+	}
+	for _, test := range tests {
+		if got := globToRegexp(test.glob); got != test.want {
+			t.Errorf("globToRegexp(%q). \nWant: %s\nGot:  %s", test.glob, test.want, got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	filter, err := New([]string{"", "# comment"})
+	if err != nil || filter != nil {
+		t.Errorf("New without rules = %v, %v, want nil filter", filter, err)
+	}
+	if !filter.Match("any/key") {
+		t.Errorf("nil filter must include every key")
+	}
+	for _, line := range []string{"*.gz", "+ ", "- re:("} {
+		if _, err = New([]string{line}); err == nil {
+			t.Errorf("New(%q) expected error", line)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"s3-crawler/pkg/files"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// copyObject copies the object on the server side by a single request. The ETag of the copy is equal
+// to the ETag of the source object.
+func (mirror *Mirror) copyObject(ctx context.Context, file *files.File, destKey string, data *files.FileCollection) error {
+	_, err := mirror.destination.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(mirror.destination.Bucket()),
+		Key:               aws.String(destKey),
+		CopySource:        mirror.copySource(file.Key),
+		CopySourceIfMatch: aws.String("\"" + file.ETag + "\""),
+	})
+	if err != nil {
+		return err
+	}
+	data.UpdateProgress(file.Size)
+	return nil
+}
+
+// copyObjectByParts copies the object on the server side by a multipart upload with UploadPartCopy.
+// It is used for objects larger than maxCopySize and for multipart objects, whose ETag can't be
+// preserved, so the source ETag is saved in the user metadata.
+func (mirror *Mirror) copyObjectByParts(ctx context.Context, file *files.File, destKey string, data *files.FileCollection) error {
+	head, err := mirror.source.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:  aws.String(mirror.source.Bucket()),
+		Key:     aws.String(file.Key),
+		IfMatch: aws.String("\"" + file.ETag + "\""),
+	})
+	if err != nil {
+		return err
+	}
+
+	upload, err := mirror.destination.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(mirror.destination.Bucket()),
+		Key:         aws.String(destKey),
+		ContentType: head.ContentType,
+		Metadata:    withSourceETag(head.Metadata, file.ETag),
+	})
+	if err != nil {
+		return err
+	}
+
+	partSize := partSize(file.Size, mirror.cfg.GetChunkSize())
+	parts := int(file.Size / partSize)
+	if file.Size%partSize != 0 {
+		parts++
+	}
+
+	completed := make([]types.CompletedPart, parts)
+	partsChan := make(chan int, parts)
+	for i := 0; i < parts; i++ {
+		partsChan <- i
+	}
+	close(partsChan)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for i := 0; i < mirror.cfg.Upload.PartConcurrency && i < parts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range partsChan {
+				start := int64(part) * partSize
+				end := start + partSize - 1
+				if end >= file.Size {
+					end = file.Size - 1
+				}
+				out, err := mirror.destination.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+					Bucket:            aws.String(mirror.destination.Bucket()),
+					Key:               aws.String(destKey),
+					UploadId:          upload.UploadId,
+					PartNumber:        int32(part + 1),
+					CopySource:        mirror.copySource(file.Key),
+					CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					CopySourceIfMatch: aws.String("\"" + file.ETag + "\""),
+				})
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+				completed[part] = types.CompletedPart{
+					ETag:       out.CopyPartResult.ETag,
+					PartNumber: int32(part + 1),
+				}
+				data.UpdateProgress(end - start + 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		_, firstErr = mirror.destination.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(mirror.destination.Bucket()),
+			Key:             aws.String(destKey),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+		})
+	}
+	if firstErr != nil {
+		_, err = mirror.destination.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(mirror.destination.Bucket()),
+			Key:      aws.String(destKey),
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			return fmt.Errorf("%w, abort multipart upload error: %v", firstErr, err)
+		}
+	}
+	return firstErr
+}
+
+// streamObject streams the object from the source endpoint to the destination endpoint.
+// The upload manager buffers only the parts in flight, so nothing is written to disk.
+func (mirror *Mirror) streamObject(ctx context.Context, file *files.File, destKey string, data *files.FileCollection) error {
+	out, err := mirror.source.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(mirror.source.Bucket()),
+		Key:     aws.String(file.Key),
+		IfMatch: aws.String("\"" + file.ETag + "\""),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	_, err = mirror.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(mirror.destination.Bucket()),
+		Key:         aws.String(destKey),
+		Body:        &progressReader{reader: out.Body, callback: data.UpdateProgress},
+		ContentType: out.ContentType,
+		Metadata:    withSourceETag(out.Metadata, file.ETag),
+	}, func(u *manager.Uploader) {
+		// The body isn't seekable, so the uploader doesn't know the size to fit the parts into maxPartCount.
+		u.PartSize = partSize(file.Size, mirror.cfg.GetChunkSize())
+	})
+	return err
+}
+
+// progressReader reports the bytes read from the source object.
+type progressReader struct {
+	reader   io.Reader
+	callback func(bytes int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	pr.callback(int64(n))
+	return n, err
+}
+
+// withSourceETag returns a copy of the metadata with the ETag of the source object.
+func withSourceETag(metadata map[string]string, etag string) map[string]string {
+	result := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		result[key] = value
+	}
+	result[sourceETagKey] = etag
+	return result
+}
+
+// urlEncodeKey encodes each segment of the key for the CopySource parameter.
+func urlEncodeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
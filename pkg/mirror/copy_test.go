@@ -0,0 +1,45 @@
+package mirror
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestURLEncodeKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"a/report.csv":      "a/report.csv",
+		"a b/report #1.csv": "a%20b/report%20%231.csv",
+		"a/?x=1/100%.csv":   "a/%3Fx=1/100%25.csv",
+		"unicode/отчёт.csv": "unicode/%D0%BE%D1%82%D1%87%D1%91%D1%82.csv",
+		"trailing/slash/":   "trailing/slash/",
+		"double//separator": "double//separator",
+	} {
+		if got := urlEncodeKey(key); got != want {
+			t.Errorf("urlEncodeKey(%s) = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestWithSourceETag(t *testing.T) {
+	metadata := map[string]string{"owner": "team"}
+	got := withSourceETag(metadata, "abc-2")
+	if got[sourceETagKey] != "abc-2" || got["owner"] != "team" {
+		t.Errorf("withSourceETag = %v", got)
+	}
+	if _, ok := metadata[sourceETagKey]; ok {
+		t.Errorf("the metadata of the source object must not be changed")
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	var reported int64
+	pr := &progressReader{reader: strings.NewReader("0123456789"), callback: func(n int64) { reported += n }}
+	data, err := io.ReadAll(pr)
+	if err != nil || string(data) != "0123456789" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if reported != 10 {
+		t.Errorf("reported %d byte(s), want 10", reported)
+	}
+}
@@ -0,0 +1,230 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/s3client"
+	"s3-crawler/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// sourceETagKey is the user metadata key with the ETag of the source object. ETags of objects
+	// created by multipart copy or upload differ from the source, so the metadata is compared instead.
+	sourceETagKey = "source-etag"
+
+	maxCopySize  = 5 * 1024 * files.MiB // maxCopySize is the maximum size of an object copied by a single request.
+	minPartSize  = 5 * files.MiB        // minPartSize is the minimum size of a part except the last one.
+	maxPartCount = 10000
+)
+
+// Mirror copies objects from the source bucket to the destination bucket.
+type Mirror struct {
+	cfg          *configuration.Configuration
+	source       *s3client.Client
+	destination  *s3client.Client
+	uploader     *manager.Uploader
+	printer      printprogress.ProgressPrinter
+	wg           sync.WaitGroup
+	activeFiles  atomic.Int32
+	skipped      atomic.Int32
+	sameEndpoint bool
+}
+
+// remoteObject is an object from the destination bucket listing.
+type remoteObject struct {
+	etag string
+	size int64
+}
+
+var mirror *Mirror
+var once sync.Once
+
+// NewMirror returns the singleton Mirror. Objects are copied on the server side if both buckets
+// are accessible by the same endpoint, otherwise they are streamed from the source to the destination
+// without touching the disk.
+func NewMirror(source, destination *s3client.Client, cfg *configuration.Configuration) *Mirror {
+	once.Do(func() {
+		mirror = &Mirror{
+			cfg:          cfg,
+			source:       source,
+			destination:  destination,
+			printer:      printprogress.NewPrinter(cfg),
+			sameEndpoint: cfg.IsSameEndpoint(),
+			uploader: manager.NewUploader(destination, func(u *manager.Uploader) {
+				u.PartSize = partSize(0, cfg.GetChunkSize())
+				u.Concurrency = cfg.Upload.PartConcurrency
+			}),
+		}
+	})
+	return mirror
+}
+
+// MirrorObjects lists both buckets and copies new and changed objects to the destination. The listings and
+// new copies are stopped by stopCtx, the copies in progress are finished unless ctx is canceled.
+func (mirror *Mirror) MirrorObjects(ctx, stopCtx context.Context) (time.Duration, error) {
+	remote := make(map[string]remoteObject)
+	err := mirror.destination.ListBucket(stopCtx, func(object types.Object) {
+		remote[*object.Key] = remoteObject{
+			etag: strings.Trim(*object.ETag, "\""),
+			size: object.Size,
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("destination: %w", err)
+	}
+
+	workers := mirror.cfg.GetDownloaders()
+	data := files.NewFileCollection(workers)
+	var pending []*files.File
+	err = mirror.source.ListBucket(stopCtx, func(object types.Object) {
+		if !mirror.source.IsValidObject(object) {
+			return
+		}
+		file := files.NewFileFromObject(object, "", false, false, false)
+		if destObject, ok := remote[mirror.destinationKey(file.Key)]; ok && destObject.etag == file.ETag && destObject.size == file.Size {
+			file.ReturnToPool()
+			return
+		}
+		data.AddToProgress(file)
+		pending = append(pending, file)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("source: %w", err)
+	}
+	fmt.Printf("Need to copy %d object(s). \n", len(pending))
+
+	start := time.Now()
+	go mirror.printer.StartProgressTicker(ctx, data, start, &mirror.activeFiles)
+
+	filesChan := make(chan *files.File, workers)
+	for i := 0; i < workers; i++ {
+		mirror.wg.Add(1)
+		go func() {
+			defer mirror.wg.Done()
+			for file := range filesChan {
+				if stopCtx.Err() != nil {
+					data.AddPending(file)
+					file.ReturnToPool()
+					continue
+				}
+				if err := mirror.copyFile(ctx, file, remote, data); err != nil {
+					data.MarkAsFailed(file, err, false)
+					log.Printf("Copy error: %v", err)
+				}
+				file.ReturnToPool()
+			}
+		}()
+	}
+	for _, file := range pending {
+		filesChan <- file
+	}
+	close(filesChan)
+	mirror.wg.Wait()
+
+	elapsed := time.Since(start)
+	_, processed, _, _, bytes, averageSpeed, _ := data.GetStatistics(elapsed)
+	// clear line
+	fmt.Print("\u001B[2K\r")
+	if data.Count() > 0 {
+		skipped := uint32(mirror.skipped.Load())
+		result := fmt.Sprintf("Copied %d object(s) in %s. Unchanged %d object(s). Total size: %s. ", processed-skipped, elapsed.Truncate(time.Millisecond), skipped, utils.FormatBytes(bytes))
+		result += fmt.Sprintf("Average copy speed = %s/s\n", utils.FormatBytes(int64(averageSpeed)))
+		fmt.Print(result)
+	} else {
+		fmt.Printf("Nothing to copy. Exit...\n")
+	}
+	if failed := len(data.Failures()); failed > 0 {
+		return elapsed, fmt.Errorf("failed to copy %d object(s)", failed)
+	}
+	if pending := len(data.Pending()); pending > 0 {
+		return elapsed, fmt.Errorf("mirror is stopped, %d object(s) are pending", pending)
+	}
+	return elapsed, nil
+}
+
+func (mirror *Mirror) copyFile(ctx context.Context, file *files.File, remote map[string]remoteObject, data *files.FileCollection) error {
+	mirror.activeFiles.Add(1)
+	defer mirror.activeFiles.Add(-1)
+
+	destKey := mirror.destinationKey(file.Key)
+	if destObject, ok := remote[destKey]; ok && destObject.size == file.Size {
+		unchanged, err := mirror.hasSourceETag(ctx, destKey, file.ETag)
+		if err != nil {
+			return fmt.Errorf("head object %s error: %w", destKey, err)
+		}
+		if unchanged {
+			mirror.skipped.Add(1)
+			data.UpdateProgress(file.Size)
+			data.MarkAsDownloaded(file)
+			return nil
+		}
+	}
+
+	var err error
+	switch {
+	case !mirror.sameEndpoint:
+		err = mirror.streamObject(ctx, file, destKey, data)
+	case !isMultipartETag(file.ETag) && file.Size <= maxCopySize:
+		err = mirror.copyObject(ctx, file, destKey, data)
+	default:
+		err = mirror.copyObjectByParts(ctx, file, destKey, data)
+	}
+	if err != nil {
+		return fmt.Errorf("copy object %s error: %w", file.Key, err)
+	}
+	data.MarkAsDownloaded(file)
+	return nil
+}
+
+// hasSourceETag reports whether the destination object was copied from the source object with the ETag.
+func (mirror *Mirror) hasSourceETag(ctx context.Context, destKey, etag string) (bool, error) {
+	head, err := mirror.destination.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(mirror.destination.Bucket()),
+		Key:    aws.String(destKey),
+	})
+	if err != nil {
+		return false, err
+	}
+	return head.Metadata[sourceETagKey] == etag, nil
+}
+
+// destinationKey replaces the source prefix of the key with the destination prefix.
+func (mirror *Mirror) destinationKey(key string) string {
+	return mirror.cfg.Destination.Prefix + strings.TrimPrefix(key, mirror.cfg.Prefix)
+}
+
+// copySource returns the URL-encoded source of the copy requests.
+func (mirror *Mirror) copySource(key string) *string {
+	return aws.String(mirror.source.Bucket() + "/" + urlEncodeKey(key))
+}
+
+// partSize returns the size of the parts the object of the size is copied by: the chunk size, but not less than
+// the minimum part size and large enough to copy the object by maxPartCount parts.
+func partSize(size, chunkSize int64) int64 {
+	partSize := chunkSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if minSize := (size + maxPartCount - 1) / maxPartCount; partSize < minSize {
+		partSize = minSize
+	}
+	return partSize
+}
+
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
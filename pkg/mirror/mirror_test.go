@@ -0,0 +1,44 @@
+package mirror
+
+import (
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+)
+
+func TestPartSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		size, chunkSize int64
+		want            int64
+	}{
+		{name: "chunk size", size: 100 * files.MiB, chunkSize: 8 * files.MiB, want: 8 * files.MiB},
+		{name: "below minimum", size: 100 * files.MiB, chunkSize: files.MiB, want: minPartSize},
+		{name: "too many parts", size: 100000 * files.MiB, chunkSize: 8 * files.MiB, want: 10 * files.MiB},
+		{name: "rounded up", size: maxPartCount*minPartSize + 1, chunkSize: files.MiB, want: minPartSize + 1},
+	}
+	for _, test := range tests {
+		got := partSize(test.size, test.chunkSize)
+		if got != test.want {
+			t.Errorf("%s: partSize(%d, %d) = %d, want %d", test.name, test.size, test.chunkSize, got, test.want)
+		}
+		if parts := (test.size + got - 1) / got; parts > maxPartCount {
+			t.Errorf("%s: %d part(s) exceed the maximum", test.name, parts)
+		}
+	}
+}
+
+func TestDestinationKey(t *testing.T) {
+	mirror := &Mirror{cfg: &configuration.Configuration{Prefix: "src/"}}
+	mirror.cfg.Destination.Prefix = "backup/src/"
+	if got := mirror.destinationKey("src/a/report.csv"); got != "backup/src/a/report.csv" {
+		t.Errorf("destinationKey = %s", got)
+	}
+}
+
+func TestIsMultipartETag(t *testing.T) {
+	if isMultipartETag("0123456789abcdef0123456789abcdef") || !isMultipartETag("0123456789abcdef0123456789abcdef-3") {
+		t.Errorf("multipart ETags must be recognized by the part count suffix")
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket which limits the number of bytes per second shared by all its users. The bucket
+// holds the tokens for one second at the current rate, so short bursts are allowed. Bytes are reserved
+// in advance, so concurrent users wait in turn. A zero rate means no limit, a nil Limiter doesn't limit anything.
+type Limiter struct {
+	rate   float64 // rate is the number of bytes per second.
+	tokens float64 // tokens is negative while the reserved bytes are not covered by the rate yet.
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// New returns a limiter with the given rate in bytes per second.
+func New(bytesPerSecond int64) *Limiter {
+	l := &Limiter{last: time.Now()}
+	l.SetRate(bytesPerSecond)
+	l.tokens = l.rate
+	return l
+}
+
+// SetRate changes the rate in bytes per second, zero removes the limit.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	l.rate = float64(bytesPerSecond)
+	if l.rate <= 0 {
+		l.rate = 0
+		l.tokens = 0
+	} else if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// Rate returns the rate in bytes per second, zero if there is no limit.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// WaitN reserves n bytes and waits until the rate allows them or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.advance(time.Now())
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// advance adds the tokens accumulated since the last call.
+func (l *Limiter) advance(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterWaitN(t *testing.T) {
+	l := New(1000)
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 1000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("burst of the full bucket waited %s", elapsed)
+	}
+	if err := l.WaitN(context.Background(), 300); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("WaitN after the burst waited %s, want about 300ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.WaitN(ctx, 10000); err == nil {
+		t.Errorf("WaitN with a canceled context must return an error")
+	}
+
+	l.SetRate(0)
+	start = time.Now()
+	if err := l.WaitN(context.Background(), 1<<30); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("WaitN without a limit = %v after %s", err, time.Since(start))
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	if err := l.WaitN(context.Background(), 1<<30); err != nil || l.Rate() != 0 {
+		t.Errorf("nil limiter must not limit, got %v, rate %d", err, l.Rate())
+	}
+}
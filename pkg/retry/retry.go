@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// retryableCodes are the error codes of throttled and timed out requests.
+var retryableCodes = map[string]bool{
+	"SlowDown":                 true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"ThrottledException":       true,
+	"RequestThrottled":         true,
+	"RequestLimitExceeded":     true,
+	"TooManyRequests":          true,
+	"TooManyRequestsException": true,
+	"RequestTimeout":           true,
+	"RequestTimeoutException":  true,
+	"InternalError":            true,
+	"ServiceUnavailable":       true,
+}
+
+// Policy describes how a failed request is retried. The delay before the retry n is BaseBackoff * 2^(n-1),
+// limited by MaxBackoff. Jitter is the random part of the delay from 0 to 1, so with the jitter 1 the delay
+// is a random value from zero to the full delay.
+type Policy struct {
+	MaxAttempts int           // MaxAttempts is the number of attempts including the first one.
+	BaseBackoff time.Duration // BaseBackoff is the delay before the first retry.
+	MaxBackoff  time.Duration // MaxBackoff is the maximum delay between attempts.
+	Jitter      float64       // Jitter is the random part of the delay from 0 to 1.
+	Timeout     time.Duration // Timeout is the timeout of a single attempt, zero means no timeout.
+}
+
+// Do calls f until it succeeds, returns an error which is not retryable or the attempts are exhausted.
+// Each attempt gets its own context with the timeout of the policy. Do stops when ctx is done.
+func (p *Policy) Do(ctx context.Context, f func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		reqCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.Timeout > 0 {
+			reqCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+		}
+		err := f(reqCtx)
+		cancel()
+		if !p.ShouldRetry(ctx, err, attempt) {
+			return err
+		}
+		delay := p.Backoff(attempt)
+		log.Printf("Request error: %v. Retry in %s (attempt %d of %d).\n", err, delay.Truncate(time.Millisecond), attempt+1, p.MaxAttempts)
+		if err := Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// ShouldRetry reports whether the error of the attempt is retryable and the attempts are not exhausted.
+func (p *Policy) ShouldRetry(ctx context.Context, err error, attempt int) bool {
+	return err != nil && ctx.Err() == nil && attempt < p.MaxAttempts && IsRetryable(err)
+}
+
+// Backoff returns the delay before the next attempt after the given failed attempt.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// Sleep waits for the delay or until ctx is done, in which case it returns the error of ctx.
+func Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsRetryable reports whether the request failed by a temporary reason: throttling, a server error,
+// a broken connection or a timeout. A canceled context, client errors like AccessDenied, NoSuchKey
+// and PreconditionFailed are not retryable. The context of the caller is checked by Policy.Do,
+// so a deadline exceeded here is the timeout of a single attempt.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && retryableCodes[apiErr.ErrorCode()] {
+		return true
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError && status != http.StatusNotImplemented
+	}
+
+	var sendErr *smithyhttp.RequestSendError
+	if errors.As(err, &sendErr) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,100 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func responseError(status int) error {
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New("response error"),
+		},
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "slow down", err: &smithy.GenericAPIError{Code: "SlowDown"}, want: true},
+		{name: "service unavailable", err: responseError(http.StatusServiceUnavailable), want: true},
+		{name: "bad gateway", err: responseError(http.StatusBadGateway), want: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "attempt timeout", err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "access denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}, want: false},
+		{name: "precondition failed", err: responseError(http.StatusPreconditionFailed), want: false},
+		{name: "not found", err: responseError(http.StatusNotFound), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("IsRetryable(%s) = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(3); got < 200*time.Millisecond || got > 400*time.Millisecond {
+			t.Fatalf("Backoff(3) with jitter = %s, want from 200ms to 400ms", got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	p := &Policy{MaxAttempts: 3, BaseBackoff: time.Millisecond, Timeout: 10 * time.Millisecond}
+
+	calls := 0
+	err := p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Do after a timed out attempt = %v with %d call(s), want nil with 2 calls", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &smithy.GenericAPIError{Code: "SlowDown"}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Do with throttling = %v with %d call(s), want error with 3 calls", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return &smithy.GenericAPIError{Code: "AccessDenied"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do with access denied = %v with %d call(s), want error with 1 call", err, calls)
+	}
+}
@@ -0,0 +1,118 @@
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const delimiter = "/"
+
+// processPrefixes discovers common prefixes with the delimiter level by level up to the fan-out depth,
+// then lists the discovered prefixes concurrently. Objects found above the depth are passed to the
+// handler during the discovery. The handler is called by one goroutine at a time.
+func (client *Client) processPrefixes(ctx context.Context, handler func(object types.Object)) error {
+	var handlerMu sync.Mutex
+	syncHandler := func(object types.Object) {
+		handlerMu.Lock()
+		defer handlerMu.Unlock()
+		handler(object)
+	}
+
+	prefixes := []string{aws.ToString(client.input.Prefix)}
+	for depth := uint8(0); depth < client.cfg.Pagination.FanOutDepth && len(prefixes) > 0; depth++ {
+		var mu sync.Mutex
+		var next []string
+		err := client.forEachPrefix(ctx, prefixes, func(ctx context.Context, prefix string) error {
+			children, err := client.discoverPrefixes(ctx, prefix, syncHandler)
+			mu.Lock()
+			next = append(next, children...)
+			mu.Unlock()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		prefixes = next
+	}
+
+	return client.forEachPrefix(ctx, prefixes, func(ctx context.Context, prefix string) error {
+		input := *client.input
+		input.Prefix = aws.String(prefix)
+		return client.processPrefix(ctx, &input, syncHandler)
+	})
+}
+
+// discoverPrefixes lists one level of the prefix with the delimiter. It passes the objects of the level
+// to the handler and returns the common prefixes of the next level.
+func (client *Client) discoverPrefixes(ctx context.Context, prefix string, handler func(object types.Object)) ([]string, error) {
+	input := *client.input
+	input.Prefix = aws.String(prefix)
+	input.Delimiter = aws.String(delimiter)
+	paginator := s3.NewListObjectsV2Paginator(client.lister, &input, func(o *s3.ListObjectsV2PaginatorOptions) {
+		o.StopOnDuplicateToken = true
+	})
+
+	var prefixes []string
+	for paginator.HasMorePages() && client.hasPageQuota() {
+		page, err := client.getPageWithRetry(ctx, paginator)
+		if err != nil {
+			return prefixes, fmt.Errorf("paginator error: %w", err)
+		}
+		for _, object := range page.Contents {
+			handler(object)
+		}
+		for _, commonPrefix := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(commonPrefix.Prefix))
+		}
+		client.countPage()
+	}
+	return prefixes, nil
+}
+
+// forEachPrefix calls fn for each prefix by a bounded pool of workers and returns the first error.
+// The first error cancels the context passed to fn, so the requests in progress are aborted and the
+// remaining prefixes are skipped.
+func (client *Client) forEachPrefix(ctx context.Context, prefixes []string, fn func(ctx context.Context, prefix string) error) error {
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	prefixChan := make(chan string, len(prefixes))
+	for _, prefix := range prefixes {
+		prefixChan <- prefix
+	}
+	close(prefixChan)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for i := 0; i < int(client.cfg.Pagination.ListWorkers) && i < len(prefixes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for prefix := range prefixChan {
+				if listCtx.Err() != nil {
+					return
+				}
+				if err := fn(listCtx, prefix); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
@@ -0,0 +1,139 @@
+package s3client
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/retry"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errListing = errors.New("access denied")
+
+// fakeLister lists the keys by pages of pageSize entries like ListObjectsV2. The listing of failPrefix fails,
+// the listing of blockPrefix waits until its context is canceled.
+type fakeLister struct {
+	keys        []string
+	pageSize    int
+	failPrefix  string
+	blockPrefix string
+	mu          sync.Mutex
+	listed      []string // listed are the prefixes of the requests.
+}
+
+func (lister *fakeLister) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	prefix := aws.ToString(params.Prefix)
+	lister.mu.Lock()
+	lister.listed = append(lister.listed, prefix)
+	lister.mu.Unlock()
+	switch {
+	case lister.failPrefix != "" && prefix == lister.failPrefix:
+		return nil, errListing
+	case lister.blockPrefix != "" && prefix == lister.blockPrefix:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	// entries are the keys and the common prefixes of the level in the order of the listing.
+	var entries []string
+	seen := make(map[string]bool)
+	for _, key := range lister.keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry := key
+		if delimiter := aws.ToString(params.Delimiter); delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+1]
+			}
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+
+	start, _ := strconv.Atoi(aws.ToString(params.ContinuationToken))
+	end := start + lister.pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	output := &s3.ListObjectsV2Output{}
+	for _, entry := range entries[start:end] {
+		if strings.HasSuffix(entry, "/") {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(entry)})
+		} else {
+			output.Contents = append(output.Contents, types.Object{Key: aws.String(entry)})
+		}
+	}
+	if end < len(entries) {
+		output.IsTruncated = true
+		output.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func newFakeClient(lister *fakeLister, fanOutDepth uint8, listWorkers uint16) *Client {
+	cfg := &configuration.Configuration{}
+	cfg.Pagination.FanOutDepth = fanOutDepth
+	cfg.Pagination.ListWorkers = listWorkers
+	return &Client{
+		cfg:     cfg,
+		lister:  lister,
+		input:   &s3.ListObjectsV2Input{Bucket: aws.String("bucket"), Prefix: aws.String("")},
+		printer: printprogress.NewStatusPrinter(context.Background(), 100, false),
+		retry:   &retry.Policy{},
+	}
+}
+
+func TestProcessPrefixes(t *testing.T) {
+	keys := []string{"root.csv", "a/1.csv", "a/2.csv", "a/b/3.csv", "a/b/4.csv", "a/c/5.csv", "d/6.csv", "d/e/f/7.csv"}
+	for _, depth := range []uint8{0, 1, 2, 3} {
+		client := newFakeClient(&fakeLister{keys: keys, pageSize: 2}, depth, 3)
+		counts := make(map[string]int)
+		err := client.processPages(context.Background(), func(object types.Object) {
+			counts[aws.ToString(object.Key)]++
+		})
+		if err != nil {
+			t.Fatalf("depth %d: processPages error: %v", depth, err)
+		}
+		if len(counts) != len(keys) {
+			t.Errorf("depth %d: listed %d key(s), want %d: %v", depth, len(counts), len(keys), counts)
+		}
+		for key, count := range counts {
+			if count != 1 {
+				t.Errorf("depth %d: key %s listed %d time(s)", depth, key, count)
+			}
+		}
+	}
+}
+
+func TestProcessPrefixesError(t *testing.T) {
+	keys := []string{"fail/1.csv", "slow/2.csv"}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, "z"+strconv.Itoa(i)+"/3.csv")
+	}
+	lister := &fakeLister{keys: keys, pageSize: 100, failPrefix: "fail/", blockPrefix: "slow/"}
+	client := newFakeClient(lister, 1, 2)
+	err := client.processPages(context.Background(), func(object types.Object) {})
+	if !errors.Is(err, errListing) {
+		t.Fatalf("processPages error = %v, want %v", err, errListing)
+	}
+	// The worker listing slow/ is canceled by the error, so no other prefix is listed.
+	for _, prefix := range lister.listed {
+		if strings.HasPrefix(prefix, "z") {
+			t.Errorf("prefix %s is listed after the error", prefix)
+		}
+	}
+}
@@ -2,36 +2,37 @@ package s3client
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"s3-crawler/pkg/archives"
 	"s3-crawler/pkg/cacher"
 	"s3-crawler/pkg/configuration"
 	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/filter"
 	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/retry"
 	"s3-crawler/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-const (
-	timeout     = 3 * time.Second
-	maxAttempts = 3
-)
-
 // Client represents an S3 client.
 type Client struct {
 	*s3.Client
+	lister       s3.ListObjectsV2APIClient    // lister is the client the paginators list the objects by.
 	cfg          *configuration.Configuration // Configuration for the S3 client.
+	bucket       string                       // Name of the bucket the client works with.
 	input        *s3.ListObjectsV2Input       // Input for the ListObjectsV2 operation.
 	wg           sync.WaitGroup               // WaitGroup to wait for goroutines to finish.
 	printer      *printprogress.Status
@@ -39,9 +40,13 @@ type Client struct {
 	nameMask     string
 	minSize      int64
 	maxSize      int64
+	after        time.Time      // after is the lower bound of the LastModified filter.
+	before       time.Time      // before is the upper bound of the LastModified filter.
+	filter       *filter.Filter // filter is the include and exclude rules for keys.
 	maxPages     int
-	pagesCount   int // Number of pages processed by the paginator.
+	pagesCount   atomic.Int64 // Number of pages processed by the paginators.
 	acceleration bool
+	retry        *retry.Policy // retry is the policy for listing and HEAD requests.
 }
 
 var s3Client *Client
@@ -53,70 +58,97 @@ var once sync.Once
 func NewClient(ctx context.Context, cfg *configuration.Configuration) (*Client, error) {
 	var err error
 	once.Do(func() {
-		s3Client = &Client{
-			cfg: cfg,
-			input: &s3.ListObjectsV2Input{
-				Bucket:  aws.String(cfg.BucketName),    // The name of the bucket to list objects from.
-				Prefix:  aws.String(cfg.Prefix),        // The prefix of the keys to list objects from.
-				MaxKeys: int32(cfg.Pagination.MaxKeys), // The maximum number of keys to return in each page of results.
-			},
-			wg:         sync.WaitGroup{},
-			printer:    printprogress.NewStatusPrinter(ctx, cfg.Progress.Delay, true),
-			minSize:    cfg.GetMinFileSize(),
-			maxSize:    cfg.GetMaxFileSize(),
-			extensions: strings.Split(cfg.Extension, ","),
-			nameMask:   strings.ToLower(cfg.NameMask),
-			maxPages:   int(cfg.Pagination.MaxPages),
-		}
-		defaultConfig, err := config.LoadDefaultConfig(ctx, config.WithEndpointResolverWithOptions(
-			aws.EndpointResolverWithOptionsFunc(
-				func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-					return aws.Endpoint{
-						URL:           cfg.S3Connection.Endpoint, // The endpoint URL to use for the S3 service.
-						SigningRegion: cfg.S3Connection.Region,   // The region to use for signing requests.
-					}, nil
-				},
-			)),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				cfg.S3Connection.AccessKeyID,     // The access key ID to use for authentication.
-				cfg.S3Connection.SecretAccessKey, // The secret access key to use for authentication.
-				"",
-			)),
-			config.WithRegion(cfg.S3Connection.Region), // The region to use for the S3 service.
-			config.WithClientLogMode(aws.LogRetries),
-			config.WithRetryMode(aws.RetryModeStandard),
-			config.WithRetryMaxAttempts(0),
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
-		s3Client.Client = s3.NewFromConfig(defaultConfig)
+		s3Client, err = newClient(ctx, cfg, cfg.S3Connection, cfg.BucketName, cfg.Prefix)
 	})
 
 	return s3Client, err
 }
 
+// NewDestinationClient creates an S3 client for the destination bucket of the mirror mode.
+func NewDestinationClient(ctx context.Context, cfg *configuration.Configuration) (*Client, error) {
+	return newClient(ctx, cfg, cfg.Destination.S3Connection, cfg.Destination.BucketName, cfg.Destination.Prefix)
+}
+
+func newClient(ctx context.Context, cfg *configuration.Configuration, connection configuration.S3ConnectionConfig, bucket, prefix string) (*Client, error) {
+	client := &Client{
+		cfg:    cfg,
+		bucket: bucket,
+		input: &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucket),            // The name of the bucket to list objects from.
+			Prefix:  aws.String(prefix),            // The prefix of the keys to list objects from.
+			MaxKeys: int32(cfg.Pagination.MaxKeys), // The maximum number of keys to return in each page of results.
+		},
+		wg:         sync.WaitGroup{},
+		printer:    printprogress.NewStatusPrinter(ctx, cfg.Progress.Delay, true),
+		minSize:    cfg.GetMinFileSize(),
+		maxSize:    cfg.GetMaxFileSize(),
+		after:      cfg.GetModifiedAfter(),
+		before:     cfg.GetModifiedBefore(),
+		filter:     cfg.GetFilter(),
+		extensions: strings.Split(cfg.Extension, ","),
+		nameMask:   strings.ToLower(cfg.NameMask),
+		maxPages:   int(cfg.Pagination.MaxPages),
+		retry:      cfg.GetRetryPolicy(),
+	}
+	defaultConfig, err := config.LoadDefaultConfig(ctx, config.WithEndpointResolverWithOptions(
+		aws.EndpointResolverWithOptionsFunc(
+			func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{
+					URL:           connection.Endpoint, // The endpoint URL to use for the S3 service.
+					SigningRegion: connection.Region,   // The region to use for signing requests.
+				}, nil
+			},
+		)),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			connection.AccessKeyID,     // The access key ID to use for authentication.
+			connection.SecretAccessKey, // The secret access key to use for authentication.
+			"",
+		)),
+		config.WithRegion(connection.Region), // The region to use for the S3 service.
+		config.WithClientLogMode(aws.LogRetries),
+		// Requests which are not retried by the policy, like uploads and copies, are retried by the SDK
+		// with the same number of attempts and the maximum backoff.
+		config.WithRetryer(func() aws.Retryer {
+			return awsretry.NewStandard(func(o *awsretry.StandardOptions) {
+				o.MaxAttempts = client.retry.MaxAttempts
+				o.MaxBackoff = client.retry.MaxBackoff
+			})
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.Client = s3.NewFromConfig(defaultConfig)
+	client.lister = client.Client
+	return client, nil
+}
+
+// Bucket returns the name of the bucket the client works with.
+func (client *Client) Bucket() string {
+	return client.bucket
+}
+
 // CheckBucket checks if the bucket specified in the configuration exists and is accessible.
 func (client *Client) CheckBucket(ctx context.Context) error {
 	err := client.doRequestWithRetry(ctx, func(reqCtx context.Context) error {
 		input := &s3.HeadBucketInput{
-			Bucket: aws.String(client.cfg.BucketName),
+			Bucket: aws.String(client.bucket),
 		}
 
-		_, err := client.HeadBucket(reqCtx, input)
+		_, err := client.HeadBucket(reqCtx, input, DisableRetries)
 		return err
 	})
 	if err != nil {
-		return fmt.Errorf("%w, Bucket name: %s", err, client.cfg.BucketName)
+		return fmt.Errorf("%w, Bucket name: %s", err, client.bucket)
 	}
-	log.Printf("Bucket exist: %s.\n", client.cfg.BucketName)
+	log.Printf("Bucket exist: %s.\n", client.bucket)
 
 	var resp *s3.GetBucketAccelerateConfigurationOutput
 	err = client.doRequestWithRetry(ctx, func(reqCtx context.Context) error {
 		var err error
 		resp, err = client.GetBucketAccelerateConfiguration(reqCtx, &s3.GetBucketAccelerateConfigurationInput{
-			Bucket: aws.String(client.cfg.BucketName),
-		})
+			Bucket: aws.String(client.bucket),
+		}, DisableRetries)
 		return err
 	})
 	if err != nil {
@@ -134,52 +166,85 @@ func (client *Client) CheckBucket(ctx context.Context) error {
 }
 
 // ListObjects lists objects from the bucket specified in the configuration and
-// sends them to be processed.
+// sends them to the DownloadChan as pages arrive. The files matched by the listing are removed
+// from the cache, the remaining ones are not present in the bucket.
 func (client *Client) ListObjects(ctx context.Context, data *files.FileCollection, cache *cacher.FileCache) error {
-	defer cache.Clear()
 	if err := client.CheckBucket(ctx); err != nil {
 		return err
 	}
 	start := time.Now()
-	if err := client.processPages(ctx, cache, data); err != nil {
+	var err error
+	if client.cfg.Versions.Mode != "" {
+		err = client.processVersions(ctx, func(version types.ObjectVersion) {
+			client.sendVersionToMap(version, cache, data)
+		})
+	} else {
+		err = client.processPages(ctx, func(object types.Object) {
+			client.sendObjectsToMap(object, cache, data)
+		})
+	}
+	if err != nil {
 		return err
 	}
 
-	fmt.Printf("All requested objects from bucket retrieved in: %s. Need to download %d file(s). \n", time.Since(start).Truncate(time.Millisecond), data.Count())
+	fmt.Printf("\u001B[2K\rAll requested objects from bucket retrieved in: %s. Need to download %d file(s). \n", time.Since(start).Truncate(time.Millisecond), data.Count())
 	return nil
 }
 
-// processPages processes pages of results returned by the paginator and sends items to be processed.
-func (client *Client) processPages(ctx context.Context, cache *cacher.FileCache, data *files.FileCollection) error {
-	paginator := s3.NewListObjectsV2Paginator(client, client.input, func(o *s3.ListObjectsV2PaginatorOptions) {
-		o.StopOnDuplicateToken = true
-	})
+// ListBucket lists all objects from the bucket with the configured prefix and passes them to the handler
+// without filtering.
+func (client *Client) ListBucket(ctx context.Context, handler func(object types.Object)) error {
+	if err := client.CheckBucket(ctx); err != nil {
+		return err
+	}
+	return client.processPages(ctx, handler)
+}
 
-	if client.maxPages == 0 {
-		client.maxPages = -1
+// processPages lists the objects from the bucket and passes them to the handler. If the fan-out depth
+// is configured, the prefixes are listed concurrently.
+func (client *Client) processPages(ctx context.Context, handler func(object types.Object)) error {
+	defer client.printer.Stop()
+	if client.cfg.Pagination.FanOutDepth > 0 {
+		return client.processPrefixes(ctx, handler)
 	}
+	return client.processPrefix(ctx, client.input, handler)
+}
 
-	for paginator.HasMorePages() && client.maxPages != client.pagesCount {
+// processPrefix processes pages of results returned by the paginator and passes items to the handler.
+func (client *Client) processPrefix(ctx context.Context, input *s3.ListObjectsV2Input, handler func(object types.Object)) error {
+	paginator := s3.NewListObjectsV2Paginator(client.lister, input, func(o *s3.ListObjectsV2PaginatorOptions) {
+		o.StopOnDuplicateToken = true
+	})
+
+	for paginator.HasMorePages() && client.hasPageQuota() {
 		page, err := client.getPageWithRetry(ctx, paginator)
 		if err != nil {
 			return fmt.Errorf("paginator error: %w", err)
 		}
 
 		for _, object := range page.Contents {
-			client.sendObjectsToMap(object, cache, data)
+			handler(object)
 		}
 
-		client.pagesCount++
-		client.printer.Send(fmt.Sprintf("Retrieving requested objects from the bucket. Current page %d", client.pagesCount))
+		client.countPage()
 	}
-	client.printer.Stop()
 
 	return nil
 }
 
+// hasPageQuota reports whether the number of processed pages is less than MaxPages.
+func (client *Client) hasPageQuota() bool {
+	return client.maxPages <= 0 || client.pagesCount.Load() < int64(client.maxPages)
+}
+
+func (client *Client) countPage() {
+	pages := client.pagesCount.Add(1)
+	client.printer.Send(fmt.Sprintf("Retrieving requested objects from the bucket. Current page %d", pages))
+}
+
 func (client *Client) getPageWithRetry(ctx context.Context, paginator *s3.ListObjectsV2Paginator) (page *s3.ListObjectsV2Output, err error) {
 	err = client.doRequestWithRetry(ctx, func(reqCtx context.Context) error {
-		page, err = paginator.NextPage(reqCtx, func(o *s3.Options) {
+		page, err = paginator.NextPage(reqCtx, DisableRetries, func(o *s3.Options) {
 			o.UseAccelerate = client.acceleration
 		})
 		return err
@@ -187,41 +252,55 @@ func (client *Client) getPageWithRetry(ctx context.Context, paginator *s3.ListOb
 	return page, err
 }
 
+// doRequestWithRetry calls f with the retry policy. The SDK retries of the request must be disabled by DisableRetries.
 func (client *Client) doRequestWithRetry(ctx context.Context, f func(context.Context) error) error {
-	var err error
-	for i := 0; i < maxAttempts; i++ {
-		reqCtx, cancel := context.WithTimeout(ctx, timeout)
-		err = f(reqCtx)
-		cancel()
-		if err == nil || !errors.Is(err, context.DeadlineExceeded) {
-			break
-		}
-		log.Printf("Request timed out, retrying... (attempt %d/%d)", i+1, maxAttempts)
-		time.Sleep(1 * time.Second)
-	}
-	return err
+	return client.retry.Do(ctx, f)
+}
+
+// DisableRetries disables the retries of the SDK for a request retried by the retry policy.
+func DisableRetries(o *s3.Options) {
+	o.Retryer = aws.NopRetryer{}
 }
 
-// sendObjectsToMap verify items and sends it's in the progressMap.
+// sendObjectsToMap verify items and sends them to the DownloadChan.
 func (client *Client) sendObjectsToMap(object types.Object, cache *cacher.FileCache, data *files.FileCollection) {
-	if name, valid := client.isValidObject(object); valid {
-		etag := strings.Trim(*object.ETag, "\"")
-		downloaded := cache.HasFile(name, etag, object.Size)
-		if !downloaded {
-			file := files.NewFileFromObject(
-				object,
-				client.cfg.LocalPath,
-				client.cfg.IsFlattenName,
-				client.cfg.IsWithDirName,
-				client.cfg.IsDecompress,
-			)
-			data.AddToProgress(file)
-		}
-		cache.RemoveFile(name)
+	if !client.IsValidObject(object) {
+		return
+	}
+	client.sendFileToMap(client.newFile(object), cache, data)
+}
+
+// sendFileToMap sends the file to the DownloadChan if it is not downloaded yet.
+// The cache is looked up by the local path of the object, so objects with the same
+// base name in different directories never collide.
+func (client *Client) sendFileToMap(file *files.File, cache *cacher.FileCache, data *files.FileCollection) {
+	key := cache.Key(file)
+	downloaded := cache.HasFile(key, file.ETag, file.Size)
+	_, exists := cache.GetFile(key)
+	cache.RemoveFile(key)
+	if downloaded {
+		file.ReturnToPool()
+		return
 	}
+	file.Reason = files.ReasonNew
+	if exists {
+		file.Reason = files.ReasonChanged
+	}
+	data.AddToDownload(file)
+}
+
+func (client *Client) newFile(object types.Object) *files.File {
+	return files.NewFileFromObject(
+		object,
+		client.cfg.LocalPath,
+		client.cfg.IsFlattenName,
+		client.cfg.IsWithDirName,
+		client.cfg.IsDecompress,
+	)
 }
 
-func (client *Client) isValidObject(object types.Object) (string, bool) {
+// IsValidObject checks the object against the extension, name, size, modification time and key filters of the configuration.
+func (client *Client) IsValidObject(object types.Object) bool {
 	// Normalize the object key by replacing slashes with underscores and converting to lowercase
 	var name string
 	if client.cfg.IsFlattenName {
@@ -239,9 +318,20 @@ func (client *Client) isValidObject(object types.Object) (string, bool) {
 	// Check if the object has a valid size
 	hasValidSize := utils.HasValidSize(object.Size, client.minSize, client.maxSize)
 
-	return name, hasValidExt && hasValidName && hasValidSize
+	// Check if the object was modified within the time window
+	hasValidModTime := utils.HasValidModTime(aws.ToTime(object.LastModified), client.after, client.before)
+
+	// Check if the key is included by the filter rules
+	hasValidKey := client.filter.Match(*object.Key)
+
+	// The members of multi-entry archives are filtered by the extension and the name on extraction
+	if client.cfg.IsDecompress && archives.IsMultiEntry(*object.Key) {
+		hasValidExt, hasValidName = true, true
+	}
+
+	return hasValidExt && hasValidName && hasValidSize && hasValidModTime && hasValidKey
 }
 
 func (client *Client) GetPagesCount() int {
-	return client.pagesCount
+	return int(client.pagesCount.Load())
 }
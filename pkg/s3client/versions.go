@@ -0,0 +1,158 @@
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"s3-crawler/pkg/cacher"
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// versionEntry is a version or a delete marker of an object.
+type versionEntry struct {
+	key            string
+	lastModified   time.Time
+	version        types.ObjectVersion
+	isDeleteMarker bool
+}
+
+// processVersions lists versions of objects and passes the versions to download to the handler.
+// In the asOf mode it is the latest version of each object modified not later than the given time,
+// objects deleted at that time are skipped. In the all mode it is every version of each object.
+// Delete markers have no data, so they are only counted.
+func (client *Client) processVersions(ctx context.Context, handler func(version types.ObjectVersion)) error {
+	defer client.printer.Stop()
+	input := &s3.ListObjectVersionsInput{
+		Bucket:  client.input.Bucket,
+		Prefix:  client.input.Prefix,
+		MaxKeys: client.input.MaxKeys,
+	}
+	paginator := s3.NewListObjectVersionsPaginator(client, input, func(o *s3.ListObjectVersionsPaginatorOptions) {
+		o.StopOnDuplicateToken = true
+	})
+
+	selector := &versionSelector{
+		asOf:  client.cfg.GetVersionsAsOf(),
+		isAll: client.cfg.Versions.Mode == configuration.VersionsAll,
+	}
+	for paginator.HasMorePages() && client.hasPageQuota() {
+		var page *s3.ListObjectVersionsOutput
+		err := client.doRequestWithRetry(ctx, func(reqCtx context.Context) error {
+			var err error
+			page, err = paginator.NextPage(reqCtx, DisableRetries, func(o *s3.Options) {
+				o.UseAccelerate = client.acceleration
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("paginator error: %w", err)
+		}
+
+		for _, entry := range mergeVersions(page) {
+			if selector.isSelected(entry) {
+				handler(entry.version)
+			}
+		}
+
+		client.countPage()
+	}
+	if selector.deleteMarkers > 0 {
+		log.Printf("Skipped %d delete marker(s).\n", selector.deleteMarkers)
+	}
+
+	return nil
+}
+
+// versionSelector chooses the versions to download from the entries of the listing in its order.
+// The state is kept between the pages, so the versions of a key may be split across pages.
+type versionSelector struct {
+	asOf          time.Time
+	isAll         bool
+	decidedKey    string // decidedKey is the last key a version or a delete marker is chosen for.
+	deleteMarkers int
+}
+
+// isSelected reports whether the version of the entry is downloaded.
+func (selector *versionSelector) isSelected(entry versionEntry) bool {
+	switch {
+	case selector.isAll && entry.isDeleteMarker:
+		selector.deleteMarkers++
+	case selector.isAll:
+		return true
+	case entry.key == selector.decidedKey || entry.lastModified.After(selector.asOf):
+		// A version of the key is already chosen or the version is newer than the asOf time.
+	case entry.isDeleteMarker:
+		selector.decidedKey = entry.key
+		selector.deleteMarkers++
+	default:
+		selector.decidedKey = entry.key
+		return true
+	}
+	return false
+}
+
+// mergeVersions merges versions and delete markers of the page ordered by key and from newest to oldest.
+// Both lists keep the order of the listing, so entries of the same list are never reordered. A version and
+// a delete marker with the same modification time are ordered by IsLatest, the current entry goes first.
+func mergeVersions(page *s3.ListObjectVersionsOutput) []versionEntry {
+	entries := make([]versionEntry, 0, len(page.Versions)+len(page.DeleteMarkers))
+	versions, markers := page.Versions, page.DeleteMarkers
+	for len(versions) > 0 || len(markers) > 0 {
+		if len(markers) == 0 || len(versions) > 0 && isVersionFirst(versions[0], markers[0]) {
+			entries = append(entries, versionEntry{
+				key:          aws.ToString(versions[0].Key),
+				lastModified: aws.ToTime(versions[0].LastModified),
+				version:      versions[0],
+			})
+			versions = versions[1:]
+			continue
+		}
+		entries = append(entries, versionEntry{
+			key:            aws.ToString(markers[0].Key),
+			lastModified:   aws.ToTime(markers[0].LastModified),
+			isDeleteMarker: true,
+		})
+		markers = markers[1:]
+	}
+	return entries
+}
+
+// isVersionFirst reports whether the version goes before the delete marker in the listing.
+func isVersionFirst(version types.ObjectVersion, marker types.DeleteMarkerEntry) bool {
+	versionKey, markerKey := aws.ToString(version.Key), aws.ToString(marker.Key)
+	if versionKey != markerKey {
+		return versionKey < markerKey
+	}
+	versionTime, markerTime := aws.ToTime(version.LastModified), aws.ToTime(marker.LastModified)
+	if !versionTime.Equal(markerTime) {
+		return versionTime.After(markerTime)
+	}
+	return !marker.IsLatest
+}
+
+// sendVersionToMap verify the version and sends it to the DownloadChan.
+func (client *Client) sendVersionToMap(version types.ObjectVersion, cache *cacher.FileCache, data *files.FileCollection) {
+	object := types.Object{
+		Key:          version.Key,
+		ETag:         version.ETag,
+		Size:         version.Size,
+		LastModified: version.LastModified,
+	}
+	if !client.IsValidObject(object) {
+		return
+	}
+	file := client.newFile(object)
+	if client.cfg.Versions.Mode == configuration.VersionsAll {
+		file.SaveAsVersion(aws.ToString(version.VersionId))
+	} else {
+		file.VersionID = aws.ToString(version.VersionId)
+	}
+	client.sendFileToMap(file, cache, data)
+}
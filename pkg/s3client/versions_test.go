@@ -0,0 +1,114 @@
+package s3client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func version(key, id string, minutes int, isLatest bool) types.ObjectVersion {
+	return types.ObjectVersion{Key: aws.String(key), VersionId: aws.String(id), LastModified: aws.Time(base.Add(time.Duration(minutes) * time.Minute)), IsLatest: isLatest}
+}
+
+func marker(key string, minutes int, isLatest bool) types.DeleteMarkerEntry {
+	return types.DeleteMarkerEntry{Key: aws.String(key), LastModified: aws.Time(base.Add(time.Duration(minutes) * time.Minute)), IsLatest: isLatest}
+}
+
+// ids returns the version ids of the entries, "marker" for the delete markers.
+func ids(entries []versionEntry) []string {
+	var result []string
+	for _, entry := range entries {
+		if entry.isDeleteMarker {
+			result = append(result, entry.key+":marker")
+		} else {
+			result = append(result, entry.key+":"+aws.ToString(entry.version.VersionId))
+		}
+	}
+	return result
+}
+
+func TestMergeVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []types.ObjectVersion
+		markers  []types.DeleteMarkerEntry
+		want     []string
+	}{
+		{
+			name:     "by key and time",
+			versions: []types.ObjectVersion{version("a", "v2", 20, true), version("a", "v1", 0, false), version("b", "v1", 5, false)},
+			markers:  []types.DeleteMarkerEntry{marker("a", 10, false), marker("b", 30, true)},
+			want:     []string{"a:v2", "a:marker", "a:v1", "b:marker", "b:v1"},
+		},
+		{
+			name:     "latest marker with the same time",
+			versions: []types.ObjectVersion{version("a", "v1", 10, false)},
+			markers:  []types.DeleteMarkerEntry{marker("a", 10, true)},
+			want:     []string{"a:marker", "a:v1"},
+		},
+		{
+			name:     "latest version with the same time",
+			versions: []types.ObjectVersion{version("a", "v2", 10, true)},
+			markers:  []types.DeleteMarkerEntry{marker("a", 10, false)},
+			want:     []string{"a:v2", "a:marker"},
+		},
+		{
+			name:     "listing order of versions with the same time",
+			versions: []types.ObjectVersion{version("a", "v3", 10, true), version("a", "v2", 10, false), version("a", "v1", 10, false)},
+			want:     []string{"a:v3", "a:v2", "a:v1"},
+		},
+	}
+	for _, test := range tests {
+		got := ids(mergeVersions(&s3.ListObjectVersionsOutput{Versions: test.versions, DeleteMarkers: test.markers}))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: mergeVersions = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVersionSelector(t *testing.T) {
+	pages := []*s3.ListObjectVersionsOutput{
+		{
+			Versions:      []types.ObjectVersion{version("a", "v2", 20, false), version("a", "v1", 0, false), version("b", "v2", 30, true)},
+			DeleteMarkers: []types.DeleteMarkerEntry{marker("a", 30, true), marker("a", 10, false)},
+		},
+		// The versions of b continue on the next page.
+		{
+			Versions:      []types.ObjectVersion{version("b", "v1", 10, false), version("c", "v1", 15, true)},
+			DeleteMarkers: []types.DeleteMarkerEntry{marker("c", 15, false)},
+		},
+	}
+	tests := []struct {
+		name          string
+		asOf          int
+		isAll         bool
+		want          []string
+		deleteMarkers int
+	}{
+		{name: "all", isAll: true, want: []string{"a:v2", "a:v1", "b:v2", "b:v1", "c:v1"}, deleteMarkers: 3},
+		{name: "before the first version", asOf: -1, want: nil},
+		{name: "deleted", asOf: 12, want: []string{"b:v1"}, deleteMarkers: 1},
+		{name: "restored", asOf: 25, want: []string{"a:v2", "b:v1", "c:v1"}},
+		{name: "latest", asOf: 60, want: []string{"b:v2", "c:v1"}, deleteMarkers: 1},
+	}
+	for _, test := range tests {
+		selector := &versionSelector{asOf: base.Add(time.Duration(test.asOf) * time.Minute), isAll: test.isAll}
+		var got []string
+		for _, page := range pages {
+			for _, entry := range mergeVersions(page) {
+				if selector.isSelected(entry) {
+					got = append(got, entry.key+":"+aws.ToString(entry.version.VersionId))
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) || selector.deleteMarkers != test.deleteMarkers {
+			t.Errorf("%s: selected %v with %d delete marker(s), want %v with %d", test.name, got, selector.deleteMarkers, test.want, test.deleteMarkers)
+		}
+	}
+}
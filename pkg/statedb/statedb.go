@@ -0,0 +1,204 @@
+package statedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// FileName is the name of the state database file in the download directory.
+	FileName = ".s3-crawler.db"
+	// CheckpointName is the name of the checkpoint file of an interrupted run in the download directory.
+	CheckpointName = ".s3-crawler.checkpoint.json"
+
+	filesBucket = "files"
+	openTimeout = time.Second
+)
+
+// Record describes a local file and the S3 object it corresponds to. An extracted multi-entry archive has
+// no local file, its record holds the number of entries and the entries refer to it by Archive.
+type Record struct {
+	Key        string `json:"key,omitempty"`        // Key is the key of the S3 object, if known.
+	ETag       string `json:"etag"`                 // ETag is the hash of the file comparable with the S3 ETag.
+	Size       int64  `json:"size"`                 // Size is the size of the local file in bytes.
+	ObjectSize int64  `json:"objectSize,omitempty"` // ObjectSize is the size of the S3 object, if known.
+	ModTime    int64  `json:"mtime"`                // ModTime is the modification time of the local file in nanoseconds.
+	Path       string `json:"path"`                 // Path is the path of the file relative to the download directory.
+	Archive    string `json:"archive,omitempty"`    // Archive is the relative path of the archive the file was extracted from.
+	Entries    int    `json:"entries,omitempty"`    // Entries is the number of extracted entries of an archive record.
+	Extracted  bool   `json:"extracted,omitempty"`  // Extracted is set for the record of an extracted multi-entry archive.
+	PartSize   int64  `json:"partSize,omitempty"`   // PartSize is the part size of the ETag calculated from the local file, 0 for the ETag of the object.
+	WithParts  bool   `json:"withParts,omitempty"`  // WithParts is set if the ETag calculated from the local file is a multipart ETag.
+	Detected   bool   `json:"detected,omitempty"`   // Detected is set for a file decompressed from an object without an extension.
+}
+
+// ErrInUse is returned when the state database is locked by another run, like a running download.
+var ErrInUse = errors.New("state database is in use by another run")
+
+// Store is a persistent embedded database of the local files state.
+type Store struct {
+	db *bolt.DB // db is nil for a read-only store without the database file, it has no records.
+}
+
+// Open opens or creates the state database in the given directory.
+func Open(dir string) (*Store, error) {
+	db, err := bolt.Open(filepath.Join(dir, FileName), 0644, &bolt.Options{
+		Timeout:        openTimeout,
+		NoFreelistSync: true,
+	})
+	if err != nil {
+		return nil, openError(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(filesBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create state database bucket error: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly opens the state database in the given directory for reading. The database isn't created,
+// a missing database is an empty store, the changes of a read-only store are ignored. The database is locked
+// exclusively by a running download, so ErrInUse is returned while it runs.
+func OpenReadOnly(dir string) (*Store, error) {
+	path := filepath.Join(dir, FileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &Store{}, nil
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{
+		Timeout:  openTimeout,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return nil, openError(err)
+	}
+	return &Store{db: db}, nil
+}
+
+// openError wraps the error of bolt.Open, the timeout of the file lock means the database is in use.
+func openError(err error) error {
+	if errors.Is(err, bolt.ErrTimeout) {
+		return fmt.Errorf("open state database error: %w", ErrInUse)
+	}
+	return fmt.Errorf("open state database error: %w", err)
+}
+
+// Get returns the record of the file with the given relative path.
+func (store *Store) Get(path string) (Record, bool) {
+	var record Record
+	var found bool
+	if store.db == nil {
+		return record, false
+	}
+	_ = store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(filesBucket))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(path))
+		if value == nil {
+			return nil
+		}
+		found = json.Unmarshal(value, &record) == nil
+		return nil
+	})
+	return record, found
+}
+
+// Put saves the record. Concurrent calls are combined into a single transaction.
+func (store *Store) Put(record Record) error {
+	if store.isReadOnly() {
+		return nil
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(filesBucket)).Put([]byte(record.Path), value)
+	})
+}
+
+// Delete removes the record of the file with the given relative path.
+func (store *Store) Delete(path string) error {
+	if store.isReadOnly() {
+		return nil
+	}
+	return store.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(filesBucket)).Delete([]byte(path))
+	})
+}
+
+// ForEach calls fn for every record in a single read transaction, fn must not modify the database.
+// Records which can't be decoded are skipped.
+func (store *Store) ForEach(fn func(record Record) error) error {
+	if store.db == nil {
+		return nil
+	}
+	return store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(filesBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			var record Record
+			if json.Unmarshal(value, &record) != nil {
+				return nil
+			}
+			return fn(record)
+		})
+	})
+}
+
+// Prune removes the records for which keep returns false, and the records which can't be decoded, in a single
+// transaction. It returns the number of removed records.
+func (store *Store) Prune(keep func(record Record) bool) (int, error) {
+	if store.isReadOnly() {
+		return 0, nil
+	}
+	var removed int
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(filesBucket))
+		var stale [][]byte
+		err := bucket.ForEach(func(key, value []byte) error {
+			var record Record
+			if json.Unmarshal(value, &record) != nil || !keep(record) {
+				stale = append(stale, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err = bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
+
+// Close closes the database.
+func (store *Store) Close() error {
+	if store.db == nil {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// isReadOnly reports whether the store is opened by OpenReadOnly.
+func (store *Store) isReadOnly() bool {
+	return store.db == nil || store.db.IsReadOnly()
+}
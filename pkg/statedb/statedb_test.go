@@ -0,0 +1,112 @@
+package statedb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePutGet(t *testing.T) {
+	tempDir, err := os.MkdirTemp(os.TempDir(), "TestStorePutGet")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store, err := Open(tempDir)
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	record := Record{Key: "dir/file.txt", ETag: "etag", Size: 10, ModTime: 42, Path: "dir/file.txt"}
+	if err = store.Put(record); err != nil {
+		t.Fatalf("Error saving record: %v", err)
+	}
+	store.Close()
+
+	store, err = Open(tempDir)
+	if err != nil {
+		t.Fatalf("Error reopening store: %v", err)
+	}
+	defer store.Close()
+	if got, ok := store.Get(record.Path); !ok || got != record {
+		t.Errorf("Record not persisted.\nWant: %+v\nGot:  %+v", record, got)
+	}
+
+	if err = store.Delete(record.Path); err != nil {
+		t.Fatalf("Error deleting record: %v", err)
+	}
+	if _, ok := store.Get(record.Path); ok {
+		t.Errorf("Record %s expected to be deleted", record.Path)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("Error opening missing store: %v", err)
+	}
+	if err = store.Put(Record{Path: "file.txt"}); err != nil {
+		t.Errorf("Put to read-only store error: %v", err)
+	}
+	store.Close()
+	if _, err = os.Stat(filepath.Join(dir, FileName)); !os.IsNotExist(err) {
+		t.Fatalf("read-only store must not create the database, stat error: %v", err)
+	}
+
+	writable, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := Record{Key: "file.txt", ETag: "etag", Size: 10, ModTime: 42, Path: "file.txt"}
+	writable.Put(record)
+	writable.Close()
+
+	store, err = OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("Error opening read-only store: %v", err)
+	}
+	defer store.Close()
+	store.Put(Record{Path: "other.txt"})
+	if got, ok := store.Get(record.Path); !ok || got != record {
+		t.Errorf("Get = %+v, %t, want %+v", got, ok, record)
+	}
+	if _, ok := store.Get("other.txt"); ok {
+		t.Errorf("read-only store must ignore Put")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		store.Put(Record{Path: path})
+	}
+	removed, err := store.Prune(func(record Record) bool {
+		return record.Path != "b.txt"
+	})
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune = %d, %v, want 1 removed", removed, err)
+	}
+	for path, want := range map[string]bool{"a.txt": true, "b.txt": false, "c.txt": true} {
+		if _, ok := store.Get(path); ok != want {
+			t.Errorf("record %s found %t, want %t", path, ok, want)
+		}
+	}
+}
+
+func TestOpenInUse(t *testing.T) {
+	dir := t.TempDir()
+	writable, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writable.Close()
+	if _, err = OpenReadOnly(dir); !errors.Is(err, ErrInUse) {
+		t.Errorf("OpenReadOnly of the database open by a run error = %v, want %v", err, ErrInUse)
+	}
+}
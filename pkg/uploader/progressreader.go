@@ -0,0 +1,55 @@
+package uploader
+
+import (
+	"os"
+	"sync"
+)
+
+// progressReader reports the bytes read from the file. It implements io.ReaderAt and io.Seeker,
+// so the manager reads parts of the file concurrently without buffering the whole file.
+// Parts may be read more than once when a request is signed or retried, so the reported bytes
+// are limited by the file size.
+type progressReader struct {
+	file     *os.File
+	callback func(bytes int64)
+	total    int64
+	read     int64
+	mu       sync.Mutex
+}
+
+func newProgressReader(file *os.File, total int64, progressCallback func(int64)) *progressReader {
+	return &progressReader{
+		file:     file,
+		callback: progressCallback,
+		total:    total,
+	}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.file.Read(p)
+	pr.report(n)
+	return n, err
+}
+
+func (pr *progressReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := pr.file.ReadAt(p, off)
+	pr.report(n)
+	return n, err
+}
+
+func (pr *progressReader) Seek(offset int64, whence int) (int64, error) {
+	return pr.file.Seek(offset, whence)
+}
+
+func (pr *progressReader) report(n int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	bytes := int64(n)
+	if pr.read+bytes > pr.total {
+		bytes = pr.total - pr.read
+	}
+	if bytes > 0 {
+		pr.read += bytes
+		pr.callback(bytes)
+	}
+}
@@ -0,0 +1,43 @@
+package uploader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var reported int64
+	pr := newProgressReader(file, 10, func(n int64) { reported += n })
+	part := make([]byte, 5)
+	// The second part is read twice, like a part which is signed before it is sent.
+	for _, off := range []int64{0, 5, 5} {
+		if _, err = pr.ReadAt(part, off); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	if reported != 10 {
+		t.Errorf("reported %d byte(s) after the parts are read again, want 10", reported)
+	}
+
+	if _, err = pr.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(pr); err != nil || string(data) != "0123456789" {
+		t.Errorf("ReadAll = %q, %v", data, err)
+	}
+	if reported != 10 {
+		t.Errorf("reported %d byte(s) after the file is read again, want 10", reported)
+	}
+}
@@ -0,0 +1,198 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"s3-crawler/pkg/cacher"
+	"s3-crawler/pkg/configuration"
+	"s3-crawler/pkg/files"
+	"s3-crawler/pkg/printprogress"
+	"s3-crawler/pkg/s3client"
+	"s3-crawler/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Uploader uploads local files to the bucket.
+type Uploader struct {
+	cfg *configuration.Configuration
+	*s3client.Client
+	uploader    *manager.Uploader
+	printer     printprogress.ProgressPrinter
+	wg          sync.WaitGroup
+	activeFiles atomic.Int32
+}
+
+// remoteObject is an object from the bucket listing.
+type remoteObject struct {
+	etag string
+	size int64
+}
+
+var uploader *Uploader
+var once sync.Once
+
+// NewUploader returns the singleton Uploader. Files are uploaded by parts of the configured chunk size,
+// so the ETags of uploaded objects are equal to the hashes calculated by the cache with parts.
+func NewUploader(client *s3client.Client, cfg *configuration.Configuration) *Uploader {
+	once.Do(func() {
+		uploader = &Uploader{
+			Client:  client,
+			cfg:     cfg,
+			wg:      sync.WaitGroup{},
+			printer: printprogress.NewPrinter(cfg),
+			uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+				u.PartSize = cfg.GetChunkSize()
+				u.Concurrency = cfg.Upload.PartConcurrency
+				u.BufferProvider = manager.NewBufferedReadSeekerWriteToPool(files.Buffer256KB)
+			}),
+		}
+	})
+	return uploader
+}
+
+// UploadFiles compares the cached local files with the bucket listing and uploads new and changed files.
+// The key of an object is the path of the file relative to the local path, so the uploaded tree has the
+// same layout as a downloaded one. The listing and new uploads are stopped by stopCtx, the uploads in
+// progress are finished unless ctx is canceled.
+func (uploader *Uploader) UploadFiles(ctx, stopCtx context.Context, cache *cacher.FileCache) (time.Duration, error) {
+	remote := make(map[string]remoteObject)
+	err := uploader.ListBucket(stopCtx, func(object types.Object) {
+		remote[*object.Key] = remoteObject{
+			etag: strings.Trim(*object.ETag, "\""),
+			size: object.Size,
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	workers := int(uploader.cfg.Upload.Uploaders)
+	data := files.NewFileCollection(workers)
+	keys := uploader.localKeys(cache)
+	var pending []*files.File
+	for _, key := range keys {
+		file, _ := cache.GetFile(key)
+		if object, ok := remote[key]; ok && object.etag == file.ETag && object.size == file.Size {
+			continue
+		}
+		file.Key = key
+		data.AddToProgress(file)
+		pending = append(pending, file)
+	}
+	fmt.Printf("Need to upload %d file(s) of %d local file(s). \n", len(pending), len(keys))
+
+	start := time.Now()
+	go uploader.printer.StartProgressTicker(ctx, data, start, &uploader.activeFiles)
+
+	filesChan := make(chan *files.File, workers)
+	for i := 0; i < workers; i++ {
+		uploader.wg.Add(1)
+		go func() {
+			defer uploader.wg.Done()
+			for file := range filesChan {
+				if stopCtx.Err() != nil {
+					data.AddPending(file)
+					continue
+				}
+				if err := uploader.uploadFile(ctx, file, data); err != nil {
+					data.MarkAsFailed(file, err, false)
+					log.Printf("Upload error: %v", err)
+				}
+			}
+		}()
+	}
+	for _, file := range pending {
+		filesChan <- file
+	}
+	close(filesChan)
+	uploader.wg.Wait()
+
+	elapsed := time.Since(start)
+	_, uploaded, _, _, bytes, averageSpeed, _ := data.GetStatistics(elapsed)
+	// clear line
+	fmt.Print("\u001B[2K\r")
+	if data.Count() > 0 {
+		result := fmt.Sprintf("Uploaded %d file(s) in %s. Total filesize: %s. ", uploaded, elapsed.Truncate(time.Millisecond), utils.FormatBytes(bytes))
+		result += fmt.Sprintf("Average upload speed = %s/s\n", utils.FormatBytes(int64(averageSpeed)))
+		fmt.Print(result)
+	} else {
+		fmt.Printf("Nothing to upload. Exit...\n")
+	}
+	if failed := len(data.Failures()); failed > 0 {
+		return elapsed, fmt.Errorf("failed to upload %d file(s)", failed)
+	}
+	if pending := len(data.Pending()); pending > 0 {
+		return elapsed, fmt.Errorf("upload is stopped, %d file(s) are pending", pending)
+	}
+	return elapsed, nil
+}
+
+// localKeys returns the keys of the local files under the prefix. The decompressed files and the files moved
+// to the trash directory weren't saved from objects with their paths, so they are never uploaded.
+func (uploader *Uploader) localKeys(cache *cacher.FileCache) []string {
+	var trashDir string
+	if uploader.cfg.Sync.TrashDir != "" {
+		if rel, err := filepath.Rel(uploader.cfg.LocalPath, uploader.cfg.Sync.TrashDir); err == nil {
+			trashDir = filepath.ToSlash(rel)
+		}
+	}
+	var keys []string
+	for _, key := range cache.Keys(uploader.cfg.Prefix, false) {
+		if strings.HasPrefix(key, uploader.cfg.Prefix) && isUploadable(key, trashDir) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isUploadable reports whether the file with the slash-separated relative path is neither in a decompressed
+// directory nor in the trash directory.
+func isUploadable(relPath, trashDir string) bool {
+	if trashDir != "" && (relPath == trashDir || strings.HasPrefix(relPath, trashDir+"/")) {
+		return false
+	}
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		if dir == files.DecompressedDir {
+			return false
+		}
+	}
+	return true
+}
+
+func (uploader *Uploader) uploadFile(ctx context.Context, file *files.File, data *files.FileCollection) error {
+	uploader.activeFiles.Add(1)
+	defer uploader.activeFiles.Add(-1)
+
+	localFile, err := os.Open(file.LocalPath())
+	if err != nil {
+		return fmt.Errorf("open file %s error: %w", file.LocalPath(), err)
+	}
+	defer localFile.Close()
+
+	body := newProgressReader(localFile, file.Size, func(n int64) {
+		data.UpdateProgress(n)
+	})
+	_, err = uploader.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(uploader.cfg.BucketName),
+		Key:    aws.String(file.Key),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("upload file %s error: %w", file.Key, err)
+	}
+	data.MarkAsDownloaded(file)
+	return nil
+}
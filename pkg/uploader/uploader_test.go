@@ -0,0 +1,23 @@
+package uploader
+
+import "testing"
+
+func TestIsUploadable(t *testing.T) {
+	tests := []struct {
+		relPath, trashDir string
+		want              bool
+	}{
+		{relPath: "a/report.csv", want: true},
+		{relPath: "report.csv", trashDir: ".trash", want: true},
+		{relPath: "decompressed/report.csv", want: false},
+		{relPath: "a/decompressed/drop.zip/report.csv", want: false},
+		{relPath: "a/decompressed.csv", want: true},
+		{relPath: ".trash/a/report.csv", trashDir: ".trash", want: false},
+		{relPath: ".trash-old/report.csv", trashDir: ".trash", want: true},
+	}
+	for _, test := range tests {
+		if got := isUploadable(test.relPath, test.trashDir); got != test.want {
+			t.Errorf("isUploadable(%s, %q) = %t, want %t", test.relPath, test.trashDir, got, test.want)
+		}
+	}
+}
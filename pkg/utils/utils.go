@@ -2,8 +2,11 @@ package utils
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,8 +23,11 @@ func CreatePath(path string) error {
 	return nil
 }
 
+// HasValidExtension checks the extension of the name. A compound extension, like .tar.gz, matches
+// both the whole extension and the last one.
 func HasValidExtension(name string, extensions []string) bool {
 	ext := filepath.Ext(name)
+	compoundExt := files.Ext(name)
 
 	if len(extensions) == 0 || (len(extensions) == 1 && extensions[0] == "") {
 		return true
@@ -31,6 +37,9 @@ func HasValidExtension(name string, extensions []string) bool {
 		if ext == validExt || (ext != "" && ext[1:] == validExt) {
 			return true
 		}
+		if compoundExt != ext && (compoundExt == validExt || compoundExt[1:] == validExt) {
+			return true
+		}
 	}
 	return false
 }
@@ -43,6 +52,33 @@ func HasValidSize(fileSize, minSize, maxSize int64) bool {
 	return (minSize == 0 || fileSize >= minSize) && (maxSize == 0 || fileSize <= maxSize)
 }
 
+// HasValidModTime checks that the modification time is within the window. Zero bounds are not checked.
+func HasValidModTime(modTime, after, before time.Time) bool {
+	return (after.IsZero() || !modTime.Before(after)) && (before.IsZero() || modTime.Before(before))
+}
+
+// ParseTime parses an absolute time in RFC3339 format or a time relative to now, like 24h or 7d.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, found := strings.CutSuffix(value, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+		}
+		return now.AddDate(0, 0, -count), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 time or duration", value)
+	}
+	return now.Add(-duration), nil
+}
+
 func FormatBytes(bytes int64) string {
 	fbytes := float64(bytes)
 	const (
@@ -66,24 +102,112 @@ func FormatBytes(bytes int64) string {
 	}
 }
 
-func SaveDataToFile(file *files.File) error {
-	defer file.ReturnToPool()
+// SaveDataToFile writes the downloaded data of the file to a temporary file and renames it to the file name,
+// so an interrupted write never leaves a truncated file under the file name. If sync is set, the data is
+// flushed to disk before the rename. The caller returns the file to the pool.
+func SaveDataToFile(file *files.File, sync bool) error {
+	return SaveReaderToFile(file, file.Data, sync)
+}
+
+// SaveReaderToFile writes the content read from r to the temporary file and renames it to the path of the file,
+// so the content is never held in memory. Symbolic links are created without reading r.
+func SaveReaderToFile(file *files.File, r io.Reader, sync bool) error {
+	if err := WriteTempFile(file, r, sync); err != nil {
+		return err
+	}
+	return CommitTempFile(file)
+}
+
+// WriteTempFile writes the content read from r to the temporary path of the file, a symbolic link is created
+// at the temporary path. The file is complete once CommitTempFile renames it, the temporary file is removed on error.
+func WriteTempFile(file *files.File, r io.Reader, sync bool) error {
 	if err := CreatePath(file.Path); err != nil {
 		return err
 	}
+	tmpPath := file.TempPath()
+	if file.Link != "" {
+		os.Remove(tmpPath)
+		if err := os.Symlink(file.Link, tmpPath); err != nil {
+			return fmt.Errorf("create link error: %w", err)
+		}
+		return nil
+	}
 
-	destinationFile, err := os.OpenFile(filepath.Join(file.Path, file.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	destinationFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("file: [key: %s, size: %d], path: %s: %w", file.Key, file.Size, file.Path, err)
 	}
 	defer destinationFile.Close()
 
-	if _, err = file.Data.WriteTo(destinationFile); err != nil {
-		return fmt.Errorf("file write error: failed to write buffer to file: %w", err)
+	if _, err = io.Copy(destinationFile, r); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("file write error: failed to write data to file: %w", err)
+	}
+	if sync {
+		if err = destinationFile.Sync(); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("file sync error: %w", err)
+		}
+	}
+	if err = destinationFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("file close error: %w", err)
+	}
+	return nil
+}
+
+// CommitTempFile renames the temporary file written by WriteTempFile to the path of the file, so an existing
+// file is replaced. The modification time is set for regular files.
+func CommitTempFile(file *files.File) error {
+	if file.Link == "" {
+		return RenameFile(file.TempPath(), file.LocalPath(), file.ModTime)
+	}
+	if err := os.Rename(file.TempPath(), file.LocalPath()); err != nil {
+		os.Remove(file.TempPath())
+		return fmt.Errorf("rename file error: %w", err)
+	}
+	return nil
+}
+
+// RenameFile sets the modification time of the complete temporary file and renames it to the path.
+// The temporary file is removed on error.
+func RenameFile(tmpPath, path string, modTime time.Time) error {
+	if err := SetModTime(tmpPath, modTime); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename file error: %w", err)
+	}
+	return nil
+}
+
+// SetModTime sets the access and modification times of the file. Zero time is skipped.
+func SetModTime(path string, modTime time.Time) error {
+	if modTime.IsZero() {
+		return nil
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		return fmt.Errorf("set modification time error: %w", err)
 	}
 	return nil
 }
 
+// ParseModTime parses the modification time saved in the user metadata of an object. The value is
+// Unix time in seconds with an optional fraction, like 1691000000.123, or a time in RFC3339 format.
+func ParseModTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid modification time %q: expected Unix time or RFC3339 time", value)
+	}
+	return t, nil
+}
+
 func TimeTrack(start time.Time, name string) {
 	elapsed := time.Since(start)
 	fmt.Print("\u001B[2K\r")
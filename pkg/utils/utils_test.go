@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"s3-crawler/pkg/files"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2023, 8, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "", want: time.Time{}},
+		{value: "2023-08-01T00:00:00Z", want: time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "90m", want: now.Add(-90 * time.Minute)},
+		{value: "7d", want: now.AddDate(0, 0, -7)},
+	}
+	for _, test := range tests {
+		got, err := ParseTime(test.value, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) error: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseTime(%q). \nWant: %s\nGot:  %s", test.value, test.want, got)
+		}
+	}
+
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Errorf("ParseTime(%q) expected error", "yesterday")
+	}
+}
+
+func TestHasValidModTime(t *testing.T) {
+	after := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		modTime time.Time
+		want    bool
+	}{
+		{modTime: after.Add(-time.Second), want: false},
+		{modTime: after, want: true},
+		{modTime: before.Add(-time.Second), want: true},
+		{modTime: before, want: false},
+	}
+	for _, test := range tests {
+		if got := HasValidModTime(test.modTime, after, before); got != test.want {
+			t.Errorf("HasValidModTime(%s) = %t, want %t", test.modTime, got, test.want)
+		}
+	}
+	if !HasValidModTime(after, time.Time{}, time.Time{}) {
+		t.Errorf("HasValidModTime without bounds expected to be true")
+	}
+}
+
+func TestParseModTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "1691000000", want: time.Unix(1691000000, 0)},
+		{value: "1691000000.25", want: time.Unix(1691000000, 250000000)},
+		{value: "2023-08-01T00:00:00.5Z", want: time.Date(2023, 8, 1, 0, 0, 0, 500000000, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseModTime(test.value)
+		if err != nil {
+			t.Errorf("ParseModTime(%q) error: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseModTime(%q). \nWant: %s\nGot:  %s", test.value, test.want, got)
+		}
+	}
+
+	if _, err := ParseModTime("yesterday"); err == nil {
+		t.Errorf("ParseModTime(%q) expected error", "yesterday")
+	}
+}
+
+func TestSaveDataToFile(t *testing.T) {
+	file := files.NewFile()
+	defer file.ReturnToPool()
+	file.Key = "dir/file.txt"
+	file.Name = "file.txt"
+	file.Path = filepath.Join(t.TempDir(), "dir")
+	file.ModTime = time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	file.Data = files.NewBuffer()
+	file.Data.WriteString("content")
+
+	if err := SaveDataToFile(file, true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file.LocalPath())
+	if err != nil || string(content) != "content" {
+		t.Errorf("saved content = %q, %v, want %q", content, err, "content")
+	}
+	if _, err = os.Stat(file.TempPath()); !os.IsNotExist(err) {
+		t.Errorf("temporary file must be renamed, stat error: %v", err)
+	}
+	info, err := os.Stat(file.LocalPath())
+	if err != nil || !info.ModTime().Equal(file.ModTime) {
+		t.Errorf("modification time = %v, want %s", info, file.ModTime)
+	}
+
+	link := files.NewFile()
+	defer link.ReturnToPool()
+	link.Key = "dir/file.txt"
+	link.Name = "link.txt"
+	link.Path = file.Path
+	link.Link = "file.txt"
+	if err = SaveDataToFile(link, true); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = os.ReadFile(link.LocalPath()); err != nil || string(content) != "content" {
+		t.Errorf("content through the link = %q, %v, want %q", content, err, "content")
+	}
+}